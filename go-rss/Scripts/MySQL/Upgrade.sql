@@ -0,0 +1,20 @@
+-- Upgrades a database created by an earlier CreTab.sql: the columns added
+-- to the existing tables. Run it before CreTab.sql, which then creates the
+-- new tables and indexes. Safe to run again (MariaDB).
+
+-- deduplication (item_key)
+alter table rss add column if not exists item_key           varchar(64);
+alter table rss add column if not exists content_hash       varchar(64);
+alter table rss add column if not exists update_date        datetime(3);
+
+-- full article text
+alter table rss add column if not exists article_content    mediumtext;
+alter table if exists rss_archive add column if not exists article_content    mediumtext;
+
+-- detected language
+alter table rss add column if not exists detected_language  varchar(8);
+alter table if exists rss_archive add column if not exists detected_language  varchar(8);
+
+-- story clusters
+alter table rss add column if not exists cluster_id         bigint;
+alter table if exists rss_archive add column if not exists cluster_id         bigint;
@@ -1,12 +1,15 @@
+drop view if exists v_rss_story;
 drop view if exists v_rss;
 
 create view v_rss as
 select
 	rs.source_name as source,
+	coalesce(r.detected_language, lower(rs.language)) as language,
 	r.title,
 	convert_tz(r.rss_date, 'UTC', 'Europe/Bucharest') local_time,
 	r.link,
-	r.description
+	r.description,
+	coalesce(r.cluster_id, r.rss_id) as story_id
 from
 	rss r
 join rss_source rs on
@@ -15,3 +18,35 @@ join rss_source rs on
 	)
 order by
 	rss_date desc;
+
+-- one row per story, with the sources that published it
+create view v_rss_story as
+select
+	s.story_id,
+	f.title,
+	convert_tz(f.rss_date, 'UTC', 'Europe/Bucharest') local_time,
+	f.link,
+	s.items,
+	s.sources
+from
+	(
+		select
+			coalesce(r.cluster_id, r.rss_id) story_id,
+			min(r.rss_id) first_rss_id,
+			count(*) items,
+			group_concat(distinct rs.source_name order by rs.source_name separator ', ') sources
+		from
+			rss r
+		join rss_source rs on
+			(
+				r.rss_source_id = rs.rss_source_id
+			)
+		group by
+			coalesce(r.cluster_id, r.rss_id)
+	) s
+join rss f on
+	(
+		f.rss_id = s.first_rss_id
+	)
+order by
+	f.rss_date desc;
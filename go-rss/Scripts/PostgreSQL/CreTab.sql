@@ -23,6 +23,18 @@ create table if not exists rss_source (
 
 create index if not exists idx_rss_source_add_date on rss_source (add_date);
 
+create table if not exists rss_link (
+    rss_link_id        serial primary key not null,
+    rss_source_id      int not null,
+    link               text not null,
+    etag               text,
+    last_modified      text,
+    change_date        timestamp not null,
+    constraint rss_link_uk unique (rss_source_id, link),
+    constraint rss_link_source_fk foreign key (rss_source_id)
+        references rss_source (rss_source_id)
+);
+
 create table if not exists rss (
     rss_id             bigserial primary key not null,
     rss_source_id      int not null,
@@ -45,6 +57,13 @@ create table if not exists rss (
     media_link         text,
     media_filetype     text,
     media_thumbnail    text,
+    item_key           varchar(64),
+    content_hash       varchar(64),
+    update_date        timestamp,
+    article_content    text,
+    detected_language  varchar(8),
+    cluster_id         bigint,
+    search_vector      tsvector,
     seen               int not null default 0,
     constraint rss_source_fk foreign key (rss_source_id)
         references rss_source (rss_source_id)
@@ -55,6 +74,172 @@ create index if not exists idx_rss_date on rss (rss_date);
 create index if not exists idx_rss_add_date on rss (add_date);
 create index if not exists idx_rss_item on rss (title, link);
 create index if not exists idx_rss_seen on rss (seen);
+create index if not exists idx_rss_detected_language on rss (detected_language);
+create index if not exists idx_rss_cluster_id on rss (cluster_id);
+create unique index if not exists idx_rss_item_key on rss (rss_source_id, item_key);
+create index if not exists idx_rss_search on rss using gin (search_vector);
+
+-- text search config used for stemming, from rss_source.language
+create or replace function rss_search_config(lang text) returns regconfig as $$
+    select case lower(left(coalesce(lang, ''), 2))
+             when 'ro' then 'romanian'
+             when 'en' then 'english'
+             when 'fr' then 'french'
+             when 'de' then 'german'
+             when 'it' then 'italian'
+             when 'es' then 'spanish'
+             when 'hu' then 'hungarian'
+             when 'ru' then 'russian'
+             else 'simple'
+           end::regconfig
+$$ language sql immutable;
+
+-- replaced by the version taking the detected language of the item
+drop function if exists rss_search_document(int, text, text, text);
+
+create or replace function rss_search_document(
+    p_rss_source_id int,
+    p_language      text,
+    p_title         text,
+    p_description   text,
+    p_content       text
+) returns tsvector as $$
+declare
+    cfg regconfig;
+begin
+    select rss_search_config(coalesce(p_language, language))
+      into cfg
+      from rss_source
+     where rss_source_id = p_rss_source_id;
+
+    cfg := coalesce(cfg, 'simple'::regconfig);
+
+    return setweight(to_tsvector(cfg, coalesce(p_title, '')), 'A') ||
+           setweight(to_tsvector(cfg, coalesce(p_description, '')), 'B') ||
+           setweight(to_tsvector(cfg, coalesce(p_content, '')), 'C');
+end
+$$ language plpgsql stable;
+
+create or replace function rss_search_vector_trg() returns trigger as $$
+begin
+    new.search_vector := rss_search_document(new.rss_source_id, new.detected_language, new.title, new.description, new.content);
+    return new;
+end
+$$ language plpgsql;
+
+drop trigger if exists rss_search_vector_trg on rss;
+
+create trigger rss_search_vector_trg
+    before insert or update of rss_source_id, detected_language, title, description, content on rss
+    for each row execute procedure rss_search_vector_trg();
+
+create table if not exists rss_alert (
+    rss_alert_id       bigserial primary key not null,
+    rss_id             bigint not null,
+    rule_name          varchar(128) not null,
+    matched            text,
+    notified           int not null default 0,
+    add_date           timestamp not null,
+    constraint rss_alert_rss_fk foreign key (rss_id)
+        references rss (rss_id)
+);
+
+create index if not exists idx_rss_alert_rss_id on rss_alert (rss_id);
+create index if not exists idx_rss_alert_add_date on rss_alert (add_date);
+
+create table if not exists rss_enclosure (
+    rss_enclosure_id   bigserial primary key not null,
+    rss_id             bigint not null,
+    kind               varchar(16) not null,
+    url                text not null,
+    content_hash       varchar(64) not null,
+    file_size          bigint not null,
+    mime_type          varchar(128),
+    file_path          text not null,
+    add_date           timestamp not null,
+    constraint rss_enclosure_rss_fk foreign key (rss_id)
+        references rss (rss_id)
+);
+
+create index if not exists idx_rss_enclosure_rss_id on rss_enclosure (rss_id);
+create index if not exists idx_rss_enclosure_hash on rss_enclosure (content_hash);
+
+create table if not exists rss_archive (
+    rss_id             bigint not null primary key,
+    rss_source_id      int not null,
+    title              text not null,
+    link               text,
+    description        text,
+    item_guid          text,
+    orig_link          text,
+    rss_date           timestamp not null,
+    add_date           timestamp not null,
+    keywords           text,
+    category           text,
+    subcategory        text,
+    content            text,
+    tags               text,
+    creator            text,
+    enclosure_link     text,
+    enclosure_length   int,
+    enclosure_filetype text,
+    media_link         text,
+    media_filetype     text,
+    media_thumbnail    text,
+    item_key           varchar(64),
+    content_hash       varchar(64),
+    update_date        timestamp,
+    article_content    text,
+    detected_language  varchar(8),
+    cluster_id         bigint,
+    seen               int not null default 0,
+    archive_date       timestamp not null
+);
+
+create index if not exists idx_rss_archive_source_id on rss_archive (rss_source_id);
+create index if not exists idx_rss_archive_rss_date on rss_archive (rss_date);
+
+create table if not exists rss_alert_archive (
+    rss_alert_id       bigint not null primary key,
+    rss_id             bigint not null,
+    rule_name          varchar(128) not null,
+    matched            text,
+    notified           int not null default 0,
+    add_date           timestamp not null,
+    archive_date       timestamp not null
+);
+
+create index if not exists idx_rss_alert_archive_rss_id on rss_alert_archive (rss_id);
+
+create table if not exists rss_health (
+    rss_health_id        serial primary key not null,
+    lowered_source_name  text not null,
+    link                 text not null,
+    http_status          int,
+    last_error           text,
+    item_count           int,
+    new_items            int,
+    latency_ms           int,
+    consecutive_failures int not null default 0,
+    failing_since        timestamp,
+    last_success         timestamp,
+    last_new_item        timestamp,
+    last_check           timestamp not null,
+    disabled             int not null default 0,
+    constraint rss_health_uk unique (lowered_source_name, link)
+);
+
+create index if not exists idx_rss_health_disabled on rss_health (disabled);
+
+-- keys of the items published to the sinks, when StoreInDatabase is false
+create table if not exists rss_published (
+    rss_source_id      int not null,
+    item_key           varchar(64) not null,
+    last_seen          timestamp not null,
+    constraint rss_published_pk primary key (rss_source_id, item_key)
+);
+
+create index if not exists idx_rss_published_last_seen on rss_published (last_seen);
 
 create table if not exists audit_log (
     audit_log_id   bigserial primary key,
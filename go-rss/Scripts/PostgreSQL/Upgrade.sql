@@ -0,0 +1,26 @@
+-- Upgrades a database created by an earlier CreTab.sql: the columns added
+-- to the existing tables. Run it before CreTab.sql, which then creates the
+-- new tables, indexes, functions and triggers. Safe to run again.
+
+-- deduplication (item_key)
+alter table rss add column if not exists item_key           varchar(64);
+alter table rss add column if not exists content_hash       varchar(64);
+alter table rss add column if not exists update_date        timestamp;
+
+-- full-text search (search_vector)
+alter table rss add column if not exists search_vector      tsvector;
+
+-- after CreTab.sql, index the existing items for the search:
+-- update rss set search_vector = rss_search_document(rss_source_id, detected_language, title, description, content) where search_vector is null;
+
+-- full article text
+alter table rss add column if not exists article_content    text;
+alter table if exists rss_archive add column if not exists article_content    text;
+
+-- detected language
+alter table rss add column if not exists detected_language  varchar(8);
+alter table if exists rss_archive add column if not exists detected_language  varchar(8);
+
+-- story clusters
+alter table rss add column if not exists cluster_id         bigint;
+alter table if exists rss_archive add column if not exists cluster_id         bigint;
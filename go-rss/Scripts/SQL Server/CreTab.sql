@@ -23,6 +23,18 @@ create table rss_source (
 
 create index idx_rss_source_add_date on rss_source (add_date);
 
+create table rss_link (
+    rss_link_id        int identity(1,1) primary key not null,
+    rss_source_id      int not null,
+    link               nvarchar(800) not null,
+    etag               nvarchar(max),
+    last_modified      nvarchar(max),
+    change_date        datetime2(3) not null,
+    constraint rss_link_uk unique (rss_source_id, link),
+    constraint rss_link_source_fk foreign key (rss_source_id)
+        references rss_source (rss_source_id)
+);
+
 create table rss (
     rss_id             bigint identity(1,1) primary key not null,
     rss_source_id      int not null,
@@ -45,6 +57,12 @@ create table rss (
     media_link         nvarchar(max),
     media_filetype     nvarchar(max),
     media_thumbnail    nvarchar(max),
+    item_key           varchar(64),
+    content_hash       varchar(64),
+    update_date        datetime2(3),
+    article_content    nvarchar(max),
+    detected_language  varchar(8),
+    cluster_id         bigint,
     seen               int not null default 0,
     constraint rss_source_fk foreign key (rss_source_id)
         references rss_source (rss_source_id)
@@ -55,6 +73,117 @@ create index idx_rss_date on rss (rss_date);
 create index idx_rss_add_date on rss (add_date);
 create index idx_rss_item on rss(rss_id) include (title, link);
 create index idx_rss_seen on rss(seen);
+create index idx_rss_detected_language on rss (detected_language);
+create index idx_rss_cluster_id on rss (cluster_id);
+create unique index idx_rss_item_key on rss (rss_source_id, item_key) where item_key is not null;
+
+create table rss_alert (
+    rss_alert_id       bigint identity(1,1) primary key not null,
+    rss_id             bigint not null,
+    rule_name          varchar(128) not null,
+    matched            nvarchar(max),
+    notified           int not null default 0,
+    add_date           datetime2(3) not null,
+    constraint rss_alert_rss_fk foreign key (rss_id)
+        references rss (rss_id)
+);
+
+create index idx_rss_alert_rss_id on rss_alert (rss_id);
+create index idx_rss_alert_add_date on rss_alert (add_date);
+
+create table rss_enclosure (
+    rss_enclosure_id   bigint identity(1,1) primary key not null,
+    rss_id             bigint not null,
+    kind               varchar(16) not null,
+    url                nvarchar(max) not null,
+    content_hash       varchar(64) not null,
+    file_size          bigint not null,
+    mime_type          varchar(128),
+    file_path          nvarchar(max) not null,
+    add_date           datetime2(3) not null,
+    constraint rss_enclosure_rss_fk foreign key (rss_id)
+        references rss (rss_id)
+);
+
+create index idx_rss_enclosure_rss_id on rss_enclosure (rss_id);
+create index idx_rss_enclosure_hash on rss_enclosure (content_hash);
+
+create table rss_archive (
+    rss_id             bigint not null primary key,
+    rss_source_id      int not null,
+    title              nvarchar(max) not null,
+    link               nvarchar(max),
+    description        nvarchar(max),
+    item_guid          nvarchar(max),
+    orig_link          nvarchar(max),
+    rss_date           datetime2(3) not null,
+    add_date           datetime2(3) not null,
+    keywords           nvarchar(max),
+    category           nvarchar(max),
+    subcategory        nvarchar(max),
+    content            nvarchar(max),
+    tags               nvarchar(max),
+    creator            nvarchar(max),
+    enclosure_link     nvarchar(max),
+    enclosure_length   int,
+    enclosure_filetype nvarchar(max),
+    media_link         nvarchar(max),
+    media_filetype     nvarchar(max),
+    media_thumbnail    nvarchar(max),
+    item_key           varchar(64),
+    content_hash       varchar(64),
+    update_date        datetime2(3),
+    article_content    nvarchar(max),
+    detected_language  varchar(8),
+    cluster_id         bigint,
+    seen               int not null default 0,
+    archive_date       datetime2(3) not null
+);
+
+create index idx_rss_archive_source_id on rss_archive (rss_source_id);
+create index idx_rss_archive_rss_date on rss_archive (rss_date);
+
+create table rss_alert_archive (
+    rss_alert_id       bigint not null primary key,
+    rss_id             bigint not null,
+    rule_name          varchar(128) not null,
+    matched            nvarchar(max),
+    notified           int not null default 0,
+    add_date           datetime2(3) not null,
+    archive_date       datetime2(3) not null
+);
+
+create index idx_rss_alert_archive_rss_id on rss_alert_archive (rss_id);
+
+create table rss_health (
+    rss_health_id        int identity(1,1) primary key not null,
+    lowered_source_name  varchar(256) not null,
+    link                 nvarchar(700) not null,
+    http_status          int,
+    last_error           nvarchar(max),
+    item_count           int,
+    new_items            int,
+    latency_ms           int,
+    consecutive_failures int not null default 0,
+    failing_since        datetime2(3),
+    last_success         datetime2(3),
+    last_new_item        datetime2(3),
+    last_check           datetime2(3) not null,
+    disabled             int not null default 0,
+    constraint rss_health_uk unique (lowered_source_name, link)
+);
+
+create index idx_rss_health_disabled on rss_health (disabled);
+
+-- keys of the items published to the sinks, when StoreInDatabase is false
+create table rss_published (
+    rss_source_id      int not null,
+    item_key           varchar(64) not null,
+    last_seen          datetime2(3) not null,
+    constraint rss_published_pk primary key (rss_source_id, item_key)
+);
+
+create index idx_rss_published_last_seen on rss_published (last_seen);
 
 create table audit_log (
     audit_log_id   bigint identity(1,1) PRIMARY KEY,
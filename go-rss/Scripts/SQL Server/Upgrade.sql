@@ -0,0 +1,46 @@
+-- Upgrades a database created by an earlier CreTab.sql: the columns added
+-- to the existing tables and their indexes. Safe to run again.
+-- Then run the create table / create index statements of CreTab.sql for
+-- the tables the database does not have yet.
+
+-- deduplication (item_key)
+if col_length('rss', 'item_key') is null
+    alter table rss add item_key varchar(64);
+if col_length('rss', 'content_hash') is null
+    alter table rss add content_hash varchar(64);
+if col_length('rss', 'update_date') is null
+    alter table rss add update_date datetime2(3);
+go
+
+if not exists (select 1 from sys.indexes where name = 'idx_rss_item_key')
+    create unique index idx_rss_item_key on rss (rss_source_id, item_key) where item_key is not null;
+go
+
+-- full article text
+if col_length('rss', 'article_content') is null
+    alter table rss add article_content nvarchar(max);
+if object_id('rss_archive') is not null and col_length('rss_archive', 'article_content') is null
+    alter table rss_archive add article_content nvarchar(max);
+go
+
+-- detected language
+if col_length('rss', 'detected_language') is null
+    alter table rss add detected_language varchar(8);
+if object_id('rss_archive') is not null and col_length('rss_archive', 'detected_language') is null
+    alter table rss_archive add detected_language varchar(8);
+go
+
+if not exists (select 1 from sys.indexes where name = 'idx_rss_detected_language')
+    create index idx_rss_detected_language on rss (detected_language);
+go
+
+-- story clusters
+if col_length('rss', 'cluster_id') is null
+    alter table rss add cluster_id bigint;
+if object_id('rss_archive') is not null and col_length('rss_archive', 'cluster_id') is null
+    alter table rss_archive add cluster_id bigint;
+go
+
+if not exists (select 1 from sys.indexes where name = 'idx_rss_cluster_id')
+    create index idx_rss_cluster_id on rss (cluster_id);
+go
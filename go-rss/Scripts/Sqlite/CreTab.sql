@@ -23,6 +23,18 @@ create table if not exists rss_source (
 
 create index if not exists idx_rss_source_add_date on rss_source (add_date);
 
+create table if not exists rss_link (
+    rss_link_id        integer primary key autoincrement not null,
+    rss_source_id      int not null,
+    link               text not null,
+    etag               text,
+    last_modified      text,
+    change_date        datetime(3) not null,
+    constraint rss_link_uk unique (rss_source_id, link),
+    constraint rss_link_source_fk foreign key (rss_source_id)
+        references rss_source (rss_source_id)
+);
+
 create table if not exists rss (
     rss_id             integer primary key autoincrement not null,
     rss_source_id      int not null,
@@ -45,6 +57,12 @@ create table if not exists rss (
     media_link         text,
     media_filetype     text,
     media_thumbnail    text,
+    item_key           varchar(64),
+    content_hash       varchar(64),
+    update_date        datetime(3),
+    article_content    mediumtext,
+    detected_language  varchar(8),
+    cluster_id         bigint,
     seen               int not null default 0,
     constraint rss_source_fk foreign key (rss_source_id)
         references rss_source (rss_source_id)
@@ -55,6 +73,144 @@ create index if not exists idx_rss_date on rss (rss_date);
 create index if not exists idx_rss_add_date on rss (add_date);
 create index if not exists idx_rss_item on rss (title, link);
 create index if not exists idx_rss_seen on rss (seen);
+create index if not exists idx_rss_detected_language on rss (detected_language);
+create index if not exists idx_rss_cluster_id on rss (cluster_id);
+create unique index if not exists idx_rss_item_key on rss (rss_source_id, item_key);
+
+-- full-text index, kept in sync with rss by the triggers below
+create virtual table if not exists rss_fts using fts5 (
+    title,
+    description,
+    content,
+    content='rss',
+    content_rowid='rss_id',
+    tokenize='porter unicode61 remove_diacritics 2'
+);
+
+create trigger if not exists rss_fts_ai after insert on rss begin
+    insert into rss_fts (rowid, title, description, content)
+    values (new.rss_id, new.title, new.description, new.content);
+end;
+
+create trigger if not exists rss_fts_ad after delete on rss begin
+    insert into rss_fts (rss_fts, rowid, title, description, content)
+    values ('delete', old.rss_id, old.title, old.description, old.content);
+end;
+
+create trigger if not exists rss_fts_au after update of title, description, content on rss begin
+    insert into rss_fts (rss_fts, rowid, title, description, content)
+    values ('delete', old.rss_id, old.title, old.description, old.content);
+    insert into rss_fts (rowid, title, description, content)
+    values (new.rss_id, new.title, new.description, new.content);
+end;
+
+create table if not exists rss_alert (
+    rss_alert_id       integer primary key autoincrement not null,
+    rss_id             bigint not null,
+    rule_name          varchar(128) not null,
+    matched            text,
+    notified           int not null default 0,
+    add_date           datetime(3) not null,
+    constraint rss_alert_rss_fk foreign key (rss_id)
+        references rss (rss_id)
+);
+
+create index if not exists idx_rss_alert_rss_id on rss_alert (rss_id);
+create index if not exists idx_rss_alert_add_date on rss_alert (add_date);
+
+create table if not exists rss_enclosure (
+    rss_enclosure_id   integer primary key autoincrement not null,
+    rss_id             bigint not null,
+    kind               varchar(16) not null,
+    url                text not null,
+    content_hash       varchar(64) not null,
+    file_size          bigint not null,
+    mime_type          varchar(128),
+    file_path          text not null,
+    add_date           datetime(3) not null,
+    constraint rss_enclosure_rss_fk foreign key (rss_id)
+        references rss (rss_id)
+);
+
+create index if not exists idx_rss_enclosure_rss_id on rss_enclosure (rss_id);
+create index if not exists idx_rss_enclosure_hash on rss_enclosure (content_hash);
+
+create table if not exists rss_archive (
+    rss_id             integer not null primary key,
+    rss_source_id      int not null,
+    title              text not null,
+    link               text,
+    description        mediumtext,
+    item_guid          text,
+    orig_link          text,
+    rss_date           datetime(3) not null,
+    add_date           datetime(3) not null,
+    keywords           text,
+    category           text,
+    subcategory        text,
+    content            mediumtext,
+    tags               text,
+    creator            text,
+    enclosure_link     text,
+    enclosure_length   int,
+    enclosure_filetype text,
+    media_link         text,
+    media_filetype     text,
+    media_thumbnail    text,
+    item_key           varchar(64),
+    content_hash       varchar(64),
+    update_date        datetime(3),
+    article_content    mediumtext,
+    detected_language  varchar(8),
+    cluster_id         bigint,
+    seen               int not null default 0,
+    archive_date       datetime(3) not null
+);
+
+create index if not exists idx_rss_archive_source_id on rss_archive (rss_source_id);
+create index if not exists idx_rss_archive_rss_date on rss_archive (rss_date);
+
+create table if not exists rss_alert_archive (
+    rss_alert_id       bigint not null primary key,
+    rss_id             bigint not null,
+    rule_name          varchar(128) not null,
+    matched            text,
+    notified           int not null default 0,
+    add_date           datetime(3) not null,
+    archive_date       datetime(3) not null
+);
+
+create index if not exists idx_rss_alert_archive_rss_id on rss_alert_archive (rss_id);
+
+create table if not exists rss_health (
+    rss_health_id        integer primary key autoincrement not null,
+    lowered_source_name  varchar(256) not null,
+    link                 text not null,
+    http_status          int,
+    last_error           text,
+    item_count           int,
+    new_items            int,
+    latency_ms           int,
+    consecutive_failures int not null default 0,
+    failing_since        datetime(3),
+    last_success         datetime(3),
+    last_new_item        datetime(3),
+    last_check           datetime(3) not null,
+    disabled             int not null default 0,
+    constraint rss_health_uk unique (lowered_source_name, link)
+);
+
+create index if not exists idx_rss_health_disabled on rss_health (disabled);
+
+-- keys of the items published to the sinks, when StoreInDatabase is false
+create table if not exists rss_published (
+    rss_source_id      int not null,
+    item_key           varchar(64) not null,
+    last_seen          datetime(3) not null,
+    constraint rss_published_pk primary key (rss_source_id, item_key)
+);
+
+create index if not exists idx_rss_published_last_seen on rss_published (last_seen);
 
 create table if not exists audit_log (
     audit_log_id   integer primary key autoincrement not null,
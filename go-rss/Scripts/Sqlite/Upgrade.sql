@@ -0,0 +1,26 @@
+-- Upgrades a database created by an earlier CreTab.sql: the columns added
+-- to the existing tables. Run it before CreTab.sql, which then creates the
+-- new tables, indexes and triggers.
+-- SQLite has no "add column if not exists": skip the statements of the
+-- columns already there ("duplicate column name"), and the rss_archive
+-- ones if the table does not exist yet.
+
+-- deduplication (item_key)
+alter table rss add column item_key           varchar(64);
+alter table rss add column content_hash       varchar(64);
+alter table rss add column update_date        datetime(3);
+
+-- full-text search (rss_fts): after CreTab.sql, index the existing items:
+-- insert into rss_fts (rss_fts) values ('rebuild');
+
+-- full article text
+alter table rss add column article_content    mediumtext;
+alter table rss_archive add column article_content    mediumtext;
+
+-- detected language
+alter table rss add column detected_language  varchar(8);
+alter table rss_archive add column detected_language  varchar(8);
+
+-- story clusters
+alter table rss add column cluster_id         bigint;
+alter table rss_archive add column cluster_id         bigint;
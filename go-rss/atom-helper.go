@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+// AtomText - Atom text construct (title, summary, content...)
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// AtomLink - Atom link element
+type AtomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Href   string `xml:"href,attr"`
+	Length int    `xml:"length,attr"`
+}
+
+// AtomPerson - Atom author / contributor
+type AtomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+}
+
+// AtomCategory - Atom category
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// AtomEntry - Atom entry struct
+type AtomEntry struct {
+	XMLName    xml.Name       `xml:"entry"`
+	ID         string         `xml:"id"`
+	Title      AtomText       `xml:"title"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+	Links      []AtomLink     `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Authors    []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+	Thumbnail  RssMediaThumbnail
+}
+
+// AtomFeed - Atom feed struct
+type AtomFeed struct {
+	XMLName   xml.Name    `xml:"feed"`
+	ID        string      `xml:"id"`
+	Title     AtomText    `xml:"title"`
+	Subtitle  AtomText    `xml:"subtitle"`
+	Links     []AtomLink  `xml:"link"`
+	Updated   string      `xml:"updated"`
+	Generator string      `xml:"generator"`
+	Rights    AtomText    `xml:"rights"`
+	Icon      string      `xml:"icon"`
+	Logo      string      `xml:"logo"`
+	Language  string      `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Entries   []AtomEntry `xml:"entry"`
+}
+
+// String - text value of the construct
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+
+	return strings.TrimSpace(t.Text)
+}
+
+// atomLink - href of the first link with the given rel
+// (a missing rel means "alternate")
+func atomLink(links []AtomLink, rel string) *AtomLink {
+	for i := range links {
+		lnkRel := links[i].Rel
+		if len(lnkRel) == 0 {
+			lnkRel = "alternate"
+		}
+
+		if lnkRel == rel {
+			return &links[i]
+		}
+	}
+
+	return nil
+}
+
+// atomDate2RSS - converts an Atom (RFC 3339) date to the RSS date format
+func atomDate2RSS(date string) string {
+	date = strings.TrimSpace(date)
+	if len(date) == 0 {
+		return ""
+	}
+
+	dt, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return date
+	}
+
+	return dt.Format(time.RFC1123Z)
+}
+
+// FillRssFeed - maps the Atom feed onto the RSS channel structure
+func (a *AtomFeed) FillRssFeed(feed *RssFeed) {
+	feed.Title = a.Title.String()
+	feed.Description = a.Subtitle.String()
+	feed.LastDate = atomDate2RSS(a.Updated)
+	feed.Generator = strings.TrimSpace(a.Generator)
+	feed.Copyright = a.Rights.String()
+
+	if len(a.Language) > 0 {
+		feed.Language = a.Language
+	}
+
+	if lnk := atomLink(a.Links, "alternate"); lnk != nil {
+		feed.Link = lnk.Href
+	}
+
+	if len(a.Logo) > 0 {
+		feed.Image.URL = strings.TrimSpace(a.Logo)
+	} else {
+		feed.Image.URL = strings.TrimSpace(a.Icon)
+	}
+	feed.Image.Title = feed.Title
+	feed.Image.Link = feed.Link
+
+	for i := range a.Entries {
+		feed.Rss = append(feed.Rss, a.Entries[i].RssItem())
+	}
+}
+
+// RssItem - maps the Atom entry onto an RSS item
+func (e *AtomEntry) RssItem() *RssItem {
+	item := RssItem{
+		Title:       e.Title.String(),
+		Description: e.Summary.String(),
+		ItemGUID:    strings.TrimSpace(e.ID),
+		Content:     e.Content.String(),
+		Thumbnail:   e.Thumbnail,
+	}
+
+	if len(e.Published) > 0 {
+		item.Date = atomDate2RSS(e.Published)
+	} else {
+		item.Date = atomDate2RSS(e.Updated)
+	}
+
+	if lnk := atomLink(e.Links, "alternate"); lnk != nil {
+		item.Link = lnk.Href
+	}
+
+	if lnk := atomLink(e.Links, "enclosure"); lnk != nil {
+		item.Enclosure = RssEnclosure{
+			URL:    lnk.Href,
+			Length: lnk.Length,
+			Type:   lnk.Type,
+		}
+	}
+
+	authors := make([]string, 0, len(e.Authors))
+	for _, author := range e.Authors {
+		if name := strings.TrimSpace(author.Name); len(name) > 0 {
+			authors = append(authors, name)
+		}
+	}
+	item.Creator = strings.Join(authors, ", ")
+
+	categories := make([]string, 0, len(e.Categories))
+	for _, category := range e.Categories {
+		if len(category.Label) > 0 {
+			categories = append(categories, category.Label)
+		} else if len(category.Term) > 0 {
+			categories = append(categories, category.Term)
+		}
+	}
+	item.Category = strings.Join(categories, ", ")
+
+	if len(item.Description) == 0 && len(item.Content) > 0 && e.Content.Type == "text" {
+		item.Description = item.Content
+	}
+
+	return &item
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// rssCommand - go-rss command, receives the arguments after its name
+type rssCommand struct {
+	Run         func(args []string) error
+	Description string
+}
+
+var commands = map[string]rssCommand{
+	"serve":        {serveCommand, "serve the gathered items as RSS 2.0, Atom and JSON Feed"},
+	"search":       {searchCommand, "full-text search of the gathered items"},
+	"search-index": {searchIndexCommand, "build / refresh the full-text index"},
+	"retention":    {retentionCommand, "archive and remove the items past the retention policy"},
+	"opml-import":  {opmlImportCommand, "add the feeds of an OPML file to rss.json"},
+	"opml-export":  {opmlExportCommand, "export the configured and gathered sources as OPML"},
+	"report":       {reportCommand, "list the dead, stale and slow sources"},
+	"enable":       {enableCommand, "enable again the links disabled after failing"},
+	"discover":     {discoverCommand, "find the feeds of a website and add them to rss.json"},
+}
+
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		return fmt.Errorf("unknown command: %s", name)
+	}
+
+	return cmd.Run(args)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+
+	fmt.Fprintf(out, "Usage: %s [flags] [command] [command flags]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Without a command the configured sources are gathered.")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(out, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-14s %s\n", name, commands[name].Description)
+	}
+}
@@ -1,20 +1,40 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"time"
 )
 
 type rssSource struct {
-	SourceName string   `json:"SourceName"`
-	Lang       string   `json:"Lang"`
-	Link       string   `json:"Link"`
-	Links      []string `json:"Links"`
-	TrustCert  bool     `json:"TrustCert"`
-	LastUpdate time.Time
-	Feed       *RSSFeed
-	FeedLnk    *RssLink
+	SourceName          string    `json:"SourceName"`
+	Lang                string    `json:"Lang"`
+	Link                string    `json:"Link,omitempty"`
+	Links               []string  `json:"Links,omitempty"`
+	TrustCert           bool      `json:"TrustCert,omitempty"`
+	PollIntervalSeconds int       `json:"PollIntervalSeconds,omitempty"`
+	PollJitterSeconds   int       `json:"PollJitterSeconds,omitempty"`
+	UpdateInPlace       bool      `json:"UpdateInPlace,omitempty"`
+	FetchFullText       bool      `json:"FetchFullText,omitempty"`
+	DownloadEnclosures  bool      `json:"DownloadEnclosures,omitempty"`
+	MaxHostConnections  int       `json:"MaxHostConnections,omitempty"`
+	MinHostSpacingMs    int       `json:"MinHostSpacingMs,omitempty"`
+	HTTPProfile         string    `json:"HTTPProfile,omitempty"`
+	KeepDays            int       `json:"KeepDays,omitempty"`
+	KeepItems           int       `json:"KeepItems,omitempty"`
+	LastUpdate          time.Time `json:"-"`
+	Feed                *RSSFeed  `json:"-"`
+	FeedLnk             *RssLink  `json:"-"`
+	// receives the outcome of each fetch in daemon mode
+	Result chan error `json:"-"`
+	// outcome of the last fetch, saved in rss_health
+	httpStatus int
+	itemCount  int
+	newItems   int
+	latency    time.Duration
 }
 
 type rssSources struct {
@@ -22,10 +42,38 @@ type rssSources struct {
 }
 
 type configuration struct {
-	DbType            string `json:"DbType"`
-	DbURL             string `json:"DbURL"`
-	RSSParalelReaders int    `json:"RSSParalelReaders"`
-	CountNewRssItems  bool   `json:"CountNewRssItems"`
+	DbType              string           `json:"DbType"`
+	DbURL               string           `json:"DbURL"`
+	RSSParalelReaders   int              `json:"RSSParalelReaders"`
+	CountNewRssItems    bool             `json:"CountNewRssItems"`
+	PollIntervalSeconds int              `json:"PollIntervalSeconds"`
+	PollJitterSeconds   int              `json:"PollJitterSeconds"`
+	MaxBackoffSeconds   int              `json:"MaxBackoffSeconds"`
+	SaveIntervalSeconds int              `json:"SaveIntervalSeconds"`
+	UpdateInPlace       bool             `json:"UpdateInPlace"`
+	ServerAddress       string           `json:"ServerAddress"`
+	AlertRules          []alertRule      `json:"AlertRules"`
+	Notifiers           []notifierConfig `json:"Notifiers"`
+	KeepDays            int              `json:"KeepDays"`
+	KeepItems           int              `json:"KeepItems"`
+	ArchiveMode         string           `json:"ArchiveMode"`
+	ArchiveDir          string           `json:"ArchiveDir"`
+	DownloadWorkers     int              `json:"DownloadWorkers"`
+	MaxArticleBytes     int64            `json:"MaxArticleBytes"`
+	MaxHostConnections  int              `json:"MaxHostConnections"`
+	MinHostSpacingMs    int              `json:"MinHostSpacingMs"`
+	DisableAfterDays    int              `json:"DisableAfterDays"`
+	StaleDays           int              `json:"StaleDays"`
+	SlowMs              int              `json:"SlowMs"`
+	HTTPClient          httpProfile      `json:"HTTPClient"`
+	HTTPProfiles        []httpProfile    `json:"HTTPProfiles"`
+	EnclosureDir        string           `json:"EnclosureDir"`
+	MaxEnclosureBytes   int64            `json:"MaxEnclosureBytes"`
+	EnclosureTypes      []string         `json:"EnclosureTypes"`
+	ClusterWindowHours  int              `json:"ClusterWindowHours"`
+	ClusterThreshold    float64          `json:"ClusterThreshold"`
+	StoreInDatabase     *bool            `json:"StoreInDatabase"`
+	Sinks               []sinkConfig     `json:"Sinks"`
 	rssSources
 }
 
@@ -49,3 +97,81 @@ func (c *configuration) ReadFromFile(cfgFile string) error {
 
 	return nil
 }
+
+// rssSourcesFile - file holding the rss sources
+func rssSourcesFile() string {
+	return fmt.Sprintf("%s/rss.json", currentDir)
+}
+
+// SaveToFile - replace the RSSSource list in the file,
+// keeping the rest of the file as it is
+func (s *rssSources) SaveToFile(cfgFile string) error {
+	data, err := ioutil.ReadFile(cfgFile)
+	if err != nil {
+		return err
+	}
+
+	start, end, err := jsonValueOffsets(data, "RSSSource")
+	if err != nil {
+		return fmt.Errorf("%s: %v", cfgFile, err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data[:start])
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("    ", "    ")
+	if err = enc.Encode(s.Rss); err != nil {
+		return err
+	}
+
+	// Encode ends the list with a new line
+	buf.Truncate(buf.Len() - 1)
+	buf.Write(data[end:])
+
+	tmpFile := cfgFile + ".tmp"
+
+	err = ioutil.WriteFile(tmpFile, buf.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, cfgFile)
+}
+
+// jsonValueOffsets - where the value of a top level key starts and ends
+func jsonValueOffsets(data []byte, key string) (int, int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	if t, err := dec.Token(); err != nil {
+		return 0, 0, err
+	} else if t != json.Delim('{') {
+		return 0, 0, fmt.Errorf("not a JSON object")
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		keyEnd := int(dec.InputOffset())
+
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return 0, 0, err
+		}
+
+		if t != key {
+			continue
+		}
+
+		end := int(dec.InputOffset())
+		start := keyEnd + bytes.IndexAny(data[keyEnd:end], "[{\"ntf0123456789-")
+
+		return start, end, nil
+	}
+
+	return 0, 0, fmt.Errorf("%s not found", key)
+}
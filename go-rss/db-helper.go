@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+)
+
+// pagingClause - LIMIT / OFFSET for the current database.
+// Must follow an ORDER BY.
+func pagingClause(limit int, offset int) (string, []interface{}) {
+	switch config.DbType {
+	case "mssql", "oci8", "godror":
+		return "OFFSET ? ROWS FETCH NEXT ? ROWS ONLY", []interface{}{offset, limit}
+	default:
+		return "LIMIT ? OFFSET ?", []interface{}{limit, offset}
+	}
+}
+
+// inClause - placeholders for an IN (...) list
+func inClause(count int) string {
+	if count <= 0 {
+		return "(NULL)"
+	}
+
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", count), ", ") + ")"
+}
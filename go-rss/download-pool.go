@@ -0,0 +1,126 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultDownloadWorkers = 4
+
+// The downloads dropped on a full queue, or failed, are queued again by the
+// backfill of their source (backfillFullText, backfillEnclosures): the
+// items added in the last downloadBackfillHours still missing what they
+// link. A download is tried maxDownloadAttempts times.
+const (
+	downloadBackfillHours = 24
+	maxDownloadAttempts   = 3
+)
+
+// downloadPool - bounded pool for the downloads made besides reading the
+// feeds, so they never hold up the rss readers
+type downloadPool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+
+	sync.Mutex
+	// the downloads tried, by key
+	attempts map[string]*downloadAttempt
+}
+
+// downloadAttempt - a download queued, running or done
+type downloadAttempt struct {
+	pending bool
+	count   int
+	first   time.Time
+}
+
+var downloads *downloadPool
+
+func newDownloadPool(workers int) *downloadPool {
+	if workers <= 0 {
+		workers = defaultDownloadWorkers
+	}
+
+	p := &downloadPool{
+		jobs:     make(chan func(), 64*workers),
+		attempts: make(map[string]*downloadAttempt),
+	}
+
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+
+		go func() {
+			defer p.wg.Done()
+
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+
+	return p
+}
+
+// Submit - queue the download of the key, unless it is already queued or
+// was tried maxDownloadAttempts times. False, and the job is dropped, if
+// the queue is full: the rss readers never wait for the downloads, the
+// backfill queues it again.
+func (p *downloadPool) Submit(key string, job func()) bool {
+	p.Lock()
+	a := p.attempts[key]
+	if a == nil {
+		a = &downloadAttempt{first: time.Now()}
+		p.attempts[key] = a
+	}
+
+	if a.pending || a.count >= maxDownloadAttempts {
+		p.Unlock()
+		return true
+	}
+
+	a.pending = true
+	a.count++
+	p.Unlock()
+
+	select {
+	case p.jobs <- func() {
+		defer p.done(a)
+		job()
+	}:
+		return true
+	default:
+		p.Lock()
+		a.pending = false
+		a.count--
+		p.Unlock()
+
+		return false
+	}
+}
+
+func (p *downloadPool) done(a *downloadAttempt) {
+	p.Lock()
+	a.pending = false
+	p.Unlock()
+}
+
+// forgetOld - drop the attempts older than the backfill, their items are
+// not looked at again
+func (p *downloadPool) forgetOld() {
+	since := time.Now().Add(-downloadBackfillHours * time.Hour)
+
+	p.Lock()
+	defer p.Unlock()
+
+	for key, a := range p.attempts {
+		if !a.pending && a.first.Before(since) {
+			delete(p.attempts, key)
+		}
+	}
+}
+
+// Close - wait for the queued jobs and stop the workers
+func (p *downloadPool) Close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
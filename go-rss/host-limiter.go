@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxHostConnections = 2
+	defaultMinHostSpacing     = 500 * time.Millisecond
+)
+
+// hostPolicy - how politely a host is fetched
+type hostPolicy struct {
+	MaxConnections int
+	MinSpacing     time.Duration
+}
+
+// hostState - requests in progress and next allowed start for a host
+type hostState struct {
+	active int
+	next   time.Time
+	// the host asked us to wait (Retry-After)
+	blockedUntil time.Time
+}
+
+// hostLimiter - per host concurrency cap and minimum spacing between requests,
+// shared by the rss readers and the download pool
+type hostLimiter struct {
+	sync.Mutex
+	cond  *sync.Cond
+	hosts map[string]*hostState
+}
+
+var hostLimits = newHostLimiter()
+
+func newHostLimiter() *hostLimiter {
+	l := &hostLimiter{hosts: make(map[string]*hostState)}
+	l.cond = sync.NewCond(&l.Mutex)
+
+	return l
+}
+
+// hostPolicy - politeness settings of the source (falls back on the global ones)
+func (s *rssSource) hostPolicy() hostPolicy {
+	policy := hostPolicy{
+		MaxConnections: defaultMaxHostConnections,
+		MinSpacing:     defaultMinHostSpacing,
+	}
+
+	if s.MaxHostConnections > 0 {
+		policy.MaxConnections = s.MaxHostConnections
+	} else if config.MaxHostConnections > 0 {
+		policy.MaxConnections = config.MaxHostConnections
+	}
+
+	if s.MinHostSpacingMs > 0 {
+		policy.MinSpacing = time.Duration(s.MinHostSpacingMs) * time.Millisecond
+	} else if config.MinHostSpacingMs > 0 {
+		policy.MinSpacing = time.Duration(config.MinHostSpacingMs) * time.Millisecond
+	}
+
+	return policy
+}
+
+func hostOf(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+
+	return strings.ToLower(u.Host)
+}
+
+func (l *hostLimiter) state(host string) *hostState {
+	s, ok := l.hosts[host]
+	if !ok {
+		s = &hostState{}
+		l.hosts[host] = s
+	}
+
+	return s
+}
+
+// Acquire - wait for a free connection and for the spacing to the previous
+// request to the host of the link. The returned func releases the connection.
+// A host blocked by Retry-After is not waited for: a retryAfterError is
+// returned at once, and the caller tries again later.
+func (l *hostLimiter) Acquire(link string, policy hostPolicy) (func(), error) {
+	host := hostOf(link)
+
+	l.Lock()
+	s := l.state(host)
+
+	for {
+		if d := time.Until(s.blockedUntil); d > 0 {
+			l.Unlock()
+			return nil, &retryAfterError{Link: link, Delay: d, Blocked: true}
+		}
+
+		if s.active < policy.MaxConnections {
+			break
+		}
+
+		l.cond.Wait()
+	}
+
+	now := time.Now()
+
+	start := now
+	if s.next.After(start) {
+		start = s.next
+	}
+
+	s.next = start.Add(policy.MinSpacing)
+	s.active++
+	l.Unlock()
+
+	time.Sleep(start.Sub(now))
+
+	return func() {
+		l.Lock()
+		s.active--
+		l.cond.Broadcast()
+		l.Unlock()
+	}, nil
+}
+
+// Block - no request is sent to the host of the link for the duration
+func (l *hostLimiter) Block(link string, d time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	s := l.state(hostOf(link))
+
+	if until := time.Now().Add(d); until.After(s.blockedUntil) {
+		s.blockedUntil = until
+	}
+
+	// the requests waiting for a connection give up
+	l.cond.Broadcast()
+}
+
+// retryAfterError - the host answered 429 / 503, now or to an earlier
+// request (Blocked)
+type retryAfterError struct {
+	Link    string
+	Status  string
+	Delay   time.Duration
+	Blocked bool
+}
+
+func (e *retryAfterError) Error() string {
+	if e.Blocked {
+		return fmt.Sprintf("%s: host blocked by Retry-After, retry after %v", e.Link, e.Delay.Round(time.Second))
+	}
+
+	return fmt.Sprintf("%s answered %s, retry after %v", e.Link, e.Status, e.Delay)
+}
+
+// checkRetryAfter - block the host as asked by a 429 / 503 answer
+// (nil for any other answer)
+func checkRetryAfter(link string, response *http.Response) error {
+	if response.StatusCode != http.StatusTooManyRequests &&
+		response.StatusCode != http.StatusServiceUnavailable {
+
+		return nil
+	}
+
+	delay := parseRetryAfter(response.Header.Get("Retry-After"))
+
+	maxBackoff := defaultMaxBackoff
+	if config.MaxBackoffSeconds > 0 {
+		maxBackoff = time.Duration(config.MaxBackoffSeconds) * time.Second
+	}
+
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+
+	hostLimits.Block(link, delay)
+
+	return &retryAfterError{Link: link, Status: response.Status, Delay: delay}
+}
+
+// parseRetryAfter - Retry-After in seconds or as a HTTP date
+// (a minute if missing or invalid)
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+
+	if dt, err := http.ParseTime(value); err == nil {
+		if d := time.Until(dt); d > 0 {
+			return d
+		}
+
+		return 0
+	}
+
+	return time.Minute
+}
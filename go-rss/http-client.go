@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpProfile - settings of the HTTP client used for fetching.
+// HTTPClient in the config is the default profile, the named profiles
+// in HTTPProfiles only override the settings they set.
+type httpProfile struct {
+	Name                         string `json:"Name,omitempty"`
+	UserAgent                    string `json:"UserAgent,omitempty"`
+	TimeoutSeconds               int    `json:"TimeoutSeconds,omitempty"`
+	ConnectTimeoutSeconds        int    `json:"ConnectTimeoutSeconds,omitempty"`
+	TLSHandshakeTimeoutSeconds   int    `json:"TLSHandshakeTimeoutSeconds,omitempty"`
+	ResponseHeaderTimeoutSeconds int    `json:"ResponseHeaderTimeoutSeconds,omitempty"`
+	IdleConnTimeoutSeconds       int    `json:"IdleConnTimeoutSeconds,omitempty"`
+	MaxIdleConnsPerHost          int    `json:"MaxIdleConnsPerHost,omitempty"`
+	// proxy url, "direct" for none (default: the HTTP(S)_PROXY environment)
+	Proxy string `json:"Proxy,omitempty"`
+	// PEM file with the CAs trusted besides the system ones
+	CABundle string `json:"CABundle,omitempty"`
+	// base64 (or hex) sha256 of the SubjectPublicKeyInfo of accepted certificates
+	PinnedCerts        []string `json:"PinnedCerts,omitempty"`
+	InsecureSkipVerify bool     `json:"InsecureSkipVerify,omitempty"`
+}
+
+// fetchClient - shared client of a profile
+type fetchClient struct {
+	*http.Client
+	UserAgent string
+}
+
+var fetchClients = struct {
+	sync.Mutex
+	clients map[string]*fetchClient
+}{clients: make(map[string]*fetchClient)}
+
+func seconds(value int, def time.Duration) time.Duration {
+	if value > 0 {
+		return time.Duration(value) * time.Second
+	}
+
+	return def
+}
+
+// merge - the profile with the settings of o applied over it
+func (p httpProfile) merge(o httpProfile) httpProfile {
+	p.Name = o.Name
+
+	if len(o.UserAgent) > 0 {
+		p.UserAgent = o.UserAgent
+	}
+	if o.TimeoutSeconds > 0 {
+		p.TimeoutSeconds = o.TimeoutSeconds
+	}
+	if o.ConnectTimeoutSeconds > 0 {
+		p.ConnectTimeoutSeconds = o.ConnectTimeoutSeconds
+	}
+	if o.TLSHandshakeTimeoutSeconds > 0 {
+		p.TLSHandshakeTimeoutSeconds = o.TLSHandshakeTimeoutSeconds
+	}
+	if o.ResponseHeaderTimeoutSeconds > 0 {
+		p.ResponseHeaderTimeoutSeconds = o.ResponseHeaderTimeoutSeconds
+	}
+	if o.IdleConnTimeoutSeconds > 0 {
+		p.IdleConnTimeoutSeconds = o.IdleConnTimeoutSeconds
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		p.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if len(o.Proxy) > 0 {
+		p.Proxy = o.Proxy
+	}
+	if len(o.CABundle) > 0 {
+		p.CABundle = o.CABundle
+	}
+	if len(o.PinnedCerts) > 0 {
+		p.PinnedCerts = o.PinnedCerts
+	}
+	if o.InsecureSkipVerify {
+		p.InsecureSkipVerify = true
+	}
+
+	return p
+}
+
+// getProfile - the named profile over the default one
+func getProfile(name string) (httpProfile, error) {
+	if len(name) == 0 {
+		return config.HTTPClient, nil
+	}
+
+	for _, p := range config.HTTPProfiles {
+		if strings.EqualFold(p.Name, name) {
+			return config.HTTPClient.merge(p), nil
+		}
+	}
+
+	return httpProfile{}, fmt.Errorf("unknown HTTP profile: %s", name)
+}
+
+// httpClient - the shared client for the source
+// (TrustCert is kept for the existing configs and skips the certificate checks)
+func (s *rssSource) httpClient() (*fetchClient, error) {
+	return getFetchClient(s.HTTPProfile, s.TrustCert)
+}
+
+// getFetchClient - the client of the profile, created on first use
+// and shared, so the connections are reused across fetches
+func getFetchClient(name string, trustCert bool) (*fetchClient, error) {
+	key := strings.ToLower(name)
+	if trustCert {
+		key += "\x00insecure"
+	}
+
+	fetchClients.Lock()
+	defer fetchClients.Unlock()
+
+	if c, ok := fetchClients.clients[key]; ok {
+		return c, nil
+	}
+
+	profile, err := getProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if trustCert {
+		profile.InsecureSkipVerify = true
+	}
+
+	c, err := profile.newClient()
+	if err != nil {
+		return nil, fmt.Errorf("HTTP profile %s: %v", name, err)
+	}
+
+	fetchClients.clients[key] = c
+
+	return c, nil
+}
+
+func (p *httpProfile) newClient() (*fetchClient, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: p.InsecureSkipVerify}
+
+	if len(p.CABundle) > 0 {
+		pem, err := ioutil.ReadFile(p.CABundle)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", p.CABundle)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(p.PinnedCerts) > 0 {
+		pins, err := parsePins(p.PinnedCerts)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, cert := range cs.PeerCertificates {
+				if pins[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+					return nil
+				}
+			}
+
+			return fmt.Errorf("%s: no pinned certificate", cs.ServerName)
+		}
+	}
+
+	proxy := http.ProxyFromEnvironment
+
+	if strings.EqualFold(p.Proxy, "direct") {
+		proxy = nil
+	} else if len(p.Proxy) > 0 {
+		proxyURL, err := url.Parse(p.Proxy)
+		if err != nil {
+			return nil, err
+		}
+
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   seconds(p.ConnectTimeoutSeconds, 10*time.Second),
+		KeepAlive: 30 * time.Second,
+	}
+
+	maxIdle := p.MaxIdleConnsPerHost
+	if maxIdle <= 0 {
+		maxIdle = 4
+	}
+
+	tr := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   seconds(p.TLSHandshakeTimeoutSeconds, 10*time.Second),
+		ResponseHeaderTimeout: seconds(p.ResponseHeaderTimeoutSeconds, 30*time.Second),
+		IdleConnTimeout:       seconds(p.IdleConnTimeoutSeconds, 90*time.Second),
+		MaxIdleConnsPerHost:   maxIdle,
+		ForceAttemptHTTP2:     true,
+	}
+
+	userAgent := p.UserAgent
+	if len(userAgent) == 0 {
+		userAgent = fmt.Sprintf("%s/%s (+https://github.com/geo-stanciu/go-tryouts)", appName, appVersion)
+	}
+
+	return &fetchClient{
+		Client: &http.Client{
+			Transport: tr,
+			Timeout:   seconds(p.TimeoutSeconds, 60*time.Second),
+		},
+		UserAgent: userAgent,
+	}, nil
+}
+
+func parsePins(list []string) (map[[sha256.Size]byte]bool, error) {
+	pins := make(map[[sha256.Size]byte]bool)
+
+	for _, pin := range list {
+		pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+
+		sum, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(sum) != sha256.Size {
+			sum, err = hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+		}
+
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("invalid pinned certificate: %s", pin)
+		}
+
+		var key [sha256.Size]byte
+		copy(key[:], sum)
+		pins[key] = true
+	}
+
+	return pins, nil
+}
+
+// withoutTimeout - the client on the same connections, without the total
+// timeout of the profile (for the large downloads, which set their own)
+func (c *fetchClient) withoutTimeout() *fetchClient {
+	return &fetchClient{
+		Client:    &http.Client{Transport: c.Client.Transport},
+		UserAgent: c.UserAgent,
+	}
+}
+
+// newRequest - GET request with the headers of the client
+func (c *fetchClient) newRequest(link string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	return req, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"strings"
 	"sync"
@@ -61,7 +62,7 @@ func (r *LastFeeds) GetFeedBySource(sourceName string) (*RSSFeed, error) {
 	return nil, nil
 }
 
-// SavelastDates - Save last RSS Dates
+// SavelastDates - Save last RSS Dates and the links cache validators
 func (r *LastFeeds) SavelastDates() error {
 	tx, err := dbutl.BeginTransaction()
 	if err != nil {
@@ -73,48 +74,98 @@ func (r *LastFeeds) SavelastDates() error {
 		return err
 	}
 
+	r.RLock()
+	defer r.RUnlock()
+
 	for _, elem := range r.RSS {
-		// for rss's that have multiple links, I get the min last rss
-		var minLastRSS time.Time
-		epochStart, _ := utils.String2date("1970-01-01", utils.UTCDate)
+		if err = saveLastDate(tx, elem); err != nil {
+			return err
+		}
+	}
 
-		for _, lnk := range elem.Links {
-			if minLastRSS.IsZero() ||
-				minLastRSS.Equal(epochStart) ||
-				(lnk.RssDate.After(epochStart) && minLastRSS.After(lnk.RssDate)) {
+	dbutl.Commit(tx)
+
+	return nil
+}
 
-				minLastRSS = lnk.RssDate
-			}
+// saveLastDate - Save the last RSS Date and the links cache validators of a source
+func saveLastDate(tx *sql.Tx, elem *RSSFeed) error {
+	elem.Lock()
+	defer elem.Unlock()
+
+	// for rss's that have multiple links, I get the min last rss
+	var minLastRSS time.Time
+	epochStart, _ := utils.String2date("1970-01-01", utils.UTCDate)
+
+	for _, lnk := range elem.Links {
+		if minLastRSS.IsZero() ||
+			minLastRSS.Equal(epochStart) ||
+			(lnk.RssDate.After(epochStart) && minLastRSS.After(lnk.RssDate)) {
+
+			minLastRSS = lnk.RssDate
 		}
+	}
 
-		var pq *utils.PreparedQuery
-
-		if !minLastRSS.IsZero() {
-			pq = dbutl.PQuery(`
-				UPDATE rss_source
-				   SET last_rss_date = ?
-				 WHERE rss_source_id = ?
-				   AND (last_rss_date IS NULL OR last_rss_date < ?)
-			`, minLastRSS.UTC(),
-				elem.SourceID,
-				minLastRSS.UTC())
-		} else {
-			pq = dbutl.PQuery(`
-				UPDATE rss_source
-				   SET last_rss_date = ?
-				 WHERE rss_source_id = ?
-				   AND last_rss_date IS NULL
-			`, "1970-01-01 00:00:00",
-				elem.SourceID)
+	var pq *utils.PreparedQuery
+
+	if !minLastRSS.IsZero() {
+		pq = dbutl.PQuery(`
+			UPDATE rss_source
+			   SET last_rss_date = ?
+			 WHERE rss_source_id = ?
+			   AND (last_rss_date IS NULL OR last_rss_date < ?)
+		`, minLastRSS.UTC(),
+			elem.SourceID,
+			minLastRSS.UTC())
+	} else {
+		pq = dbutl.PQuery(`
+			UPDATE rss_source
+			   SET last_rss_date = ?
+			 WHERE rss_source_id = ?
+			   AND last_rss_date IS NULL
+		`, "1970-01-01 00:00:00",
+			elem.SourceID)
+	}
+
+	_, err := dbutl.ExecTx(tx, pq)
+	if err != nil {
+		return err
+	}
+
+	if elem.SourceID <= 0 {
+		return nil
+	}
+
+	// long running gatherers only look for items newer than this
+	// (the retention command may also have moved it forward)
+	pq = dbutl.PQuery(`
+		SELECT last_rss_date,
+		       rss_source_id
+		  FROM rss_source
+		 WHERE rss_source_id = ?
+	`, elem.SourceID)
+
+	lastDt := rssLastDate{}
+	err = dbutl.RunQueryTx(tx, pq, &lastDt)
+	if err != nil {
+		return err
+	}
+
+	if lastDt.LastDate.After(elem.LastUpdate) {
+		elem.LastUpdate = lastDt.LastDate
+	}
+
+	for _, lnk := range elem.Links {
+		if !lnk.validatorsChanged {
+			continue
 		}
 
-		_, err = dbutl.ExecTx(tx, pq)
-		if err != nil {
+		if err = lnk.saveValidators(tx, elem.SourceID); err != nil {
 			return err
 		}
-	}
 
-	dbutl.Commit(tx)
+		lnk.validatorsChanged = false
+	}
 
 	return nil
 }
@@ -1,17 +1,17 @@
 package main
 
 import (
-	"crypto/tls"
+	"bytes"
 	"database/sql"
 	"encoding/xml"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
@@ -64,7 +64,9 @@ func main() {
 	var wg sync.WaitGroup
 
 	cfgPtr := flag.String("c", fmt.Sprintf("%s/conf.json", currentDir), "config file")
+	daemonPtr := flag.Bool("daemon", false, "keep running and poll each source at its own interval")
 
+	flag.Usage = usage
 	flag.Parse()
 
 	if _, err = os.Stat(*cfgPtr); os.IsNotExist(err) {
@@ -78,7 +80,7 @@ func main() {
 		return
 	}
 
-	err = config.ReadFromFile(fmt.Sprintf("%s/rss.json", currentDir))
+	err = config.ReadFromFile(rssSourcesFile())
 	if err != nil {
 		log.Println(err)
 		return
@@ -98,65 +100,129 @@ func main() {
 	mw := io.MultiWriter(os.Stdout, audit)
 	log.Out = mw
 
+	if cmd := flag.Arg(0); len(cmd) > 0 {
+		err = runCommand(cmd, flag.Args()[1:])
+		if err != nil {
+			audit.Log(err, cmd, "Command failed.")
+		}
+	} else {
+		gatherRSS(&wg, *daemonPtr)
+	}
+
+	// wait for all logs to be written
+	wg.Wait()
+}
+
+// gatherRSS - read the configured sources and save the new items
+func gatherRSS(wg *sync.WaitGroup, daemon bool) {
+	if err := prepareAlerts(); err != nil {
+		audit.Log(err, "gather rss", "Import failed.")
+		return
+	}
+
+	if err := prepareSinks(); err != nil {
+		audit.Log(err, "gather rss", "Import failed.")
+		return
+	}
+	defer closeSinks()
+
+	downloads = newDownloadPool(config.DownloadWorkers)
+	defer downloads.Close()
+
 	// initialize the rss readers
 	for i := 0; i < config.RSSParalelReaders; i++ {
-		go dealWithRSS(&wg)
+		go dealWithRSS(wg)
+	}
+
+	if err := loadDisabledLinks(); err != nil {
+		audit.Log(err, "gather rss", "Import failed.")
+		return
+	}
+
+	sources, err := getRssSources()
+	if err != nil {
+		audit.Log(err, "gather rss", "Import failed.")
+		return
 	}
 
+	if daemon {
+		runDaemon(sources)
+	} else {
+		for _, rss := range sources {
+			queue <- rss
+		}
+
+		// wait for all rss to be done
+		wg.Wait()
+
+		saveGatherResults()
+	}
+
+	close(queue)
+}
+
+// getRssSources - one rssSource for each link of the configured sources
+func getRssSources() ([]rssSource, error) {
+	var sources []rssSource
+
 	for _, rss := range config.Rss {
 		lastUpdate, err := getLastRSS(rss.SourceName)
 		if err != nil {
-			audit.Log(err, "gather rss", "Import failed.")
-			return
+			return nil, err
 		}
 		rss.LastUpdate = lastUpdate
 
-		if len(rss.Link) > 0 {
-			queue <- rss
+		if len(rss.Link) > 0 && !rss.skipDisabled() {
+			sources = append(sources, rss)
 		}
 
 		for _, lnk := range rss.Links {
-			rss1 := rssSource{
-				SourceName: rss.SourceName,
-				Lang:       rss.Lang,
-				Link:       lnk,
-				LastUpdate: rss.LastUpdate,
+			rss1 := rss
+			rss1.Link = lnk
+			rss1.Links = nil
+
+			if !rss1.skipDisabled() {
+				sources = append(sources, rss1)
 			}
-			queue <- rss1
 		}
 	}
 
-	// wait for all rss to be done
-	wg.Wait()
+	return sources, nil
+}
+
+// saveGatherResults - Save the last rss dates and log the outcome
+func saveGatherResults() {
+	// no feed is saved while the last dates are written
+	rssLock.Lock()
+	err := lastFeeds.SavelastDates()
+	rssLock.Unlock()
 
-	err = lastFeeds.SavelastDates()
 	if err != nil {
 		audit.Log(err, "gather rss", "Import failed.")
+		return
+	}
+
+	mutex.Lock()
+
+	if errFound {
+		err = errors.New("errors found while gathering rss")
+		if config.CountNewRssItems {
+			audit.Log(err, "gather rss", "Import failed.", "new_rss_items", newItems)
+		} else {
+			audit.Log(err, "gather rss", "Import failed.")
+		}
 	} else {
-		mutex.Lock()
-
-		if errFound {
-			err = errors.New("errors found while gathering rss")
-			if config.CountNewRssItems {
-				audit.Log(err, "gather rss", "Import failed.", "new_rss_items", newItems)
-			} else {
-				audit.Log(err, "gather rss", "Import failed.")
-			}
+		if config.CountNewRssItems {
+			audit.Log(nil, "gather rss", "Import done.", "new_rss_items", newItems)
 		} else {
-			if config.CountNewRssItems {
-				audit.Log(nil, "gather rss", "Import done.", "new_rss_items", newItems)
-			} else {
-				audit.Log(nil, "gather rss", "Import done.")
-			}
+			audit.Log(nil, "gather rss", "Import done.")
 		}
-
-		mutex.Unlock()
 	}
 
-	// wait for all logs to be written
-	wg.Wait()
+	errFound = false
+	newItems = 0
 
-	close(queue)
+	mutex.Unlock()
 }
 
 func dealWithRSS(wg *sync.WaitGroup) {
@@ -188,6 +254,7 @@ func dealWithRSS(wg *sync.WaitGroup) {
 			)
 
 			lastFeeds.Unlock()
+			rss.Done(err)
 			wg.Done()
 			continue
 		}
@@ -201,11 +268,14 @@ func dealWithRSS(wg *sync.WaitGroup) {
 		if rss.FeedLnk = rss.Feed.GetLink(rss.Link); rss.FeedLnk == nil {
 			rss.FeedLnk = new(RssLink)
 			rss.FeedLnk.Link = rss.Link
+			err = rss.FeedLnk.LoadValidators(rss.SourceName)
 			rss.Feed.Links = append(rss.Feed.Links, rss.FeedLnk)
 		}
 		lastFeeds.Unlock()
 
-		err = getStreamFromURL(&rss, parseXMLSource)
+		if err == nil {
+			err = getStreamFromURL(&rss, parseXMLSource)
+		}
 
 		if err != nil {
 			mutex.Lock()
@@ -213,10 +283,9 @@ func dealWithRSS(wg *sync.WaitGroup) {
 			mutex.Unlock()
 		}
 
-		newRss := 0
-		rss.Feed.Lock()
-		newRss = rss.FeedLnk.NewItems
-		rss.Feed.Unlock()
+		if herr := rss.recordHealth(err); herr != nil {
+			audit.Log(herr, "feed health", "save failed", "source", rss.SourceName, "link", rss.Link)
+		}
 
 		endTime := time.Now()
 
@@ -226,54 +295,140 @@ func dealWithRSS(wg *sync.WaitGroup) {
 			"lang", rss.Lang,
 			"source", rss.SourceName,
 			"link", rss.Link,
-			"new_rss_items", newRss,
+			"new_rss_items", rss.newItems,
 			"time_elapsed_ms", endTime.Sub(startTime)/1E6,
 		)
 
-		time.Sleep(10 * time.Millisecond)
-
+		rss.Done(err)
 		wg.Done()
 	}
 }
 
 func getStreamFromURL(rss *rssSource, callback ParseSourceStream) error {
-	var client *http.Client
+	client, err := rss.httpClient()
+	if err != nil {
+		return err
+	}
 
-	if rss.TrustCert && strings.HasPrefix(rss.Link, "https") {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
+	req, err := client.newRequest(rss.Link)
+	if err != nil {
+		return err
+	}
 
-		client = &http.Client{Transport: tr}
-	} else {
-		client = &http.Client{}
+	rss.Feed.RLock()
+	if len(rss.FeedLnk.ETag) > 0 {
+		req.Header.Set("If-None-Match", rss.FeedLnk.ETag)
+	}
+	if len(rss.FeedLnk.LastModified) > 0 {
+		req.Header.Set("If-Modified-Since", rss.FeedLnk.LastModified)
+	}
+	rss.Feed.RUnlock()
+
+	response, body, err := fetchFeed(rss, client, req)
+	if err != nil {
+		return err
+	}
+
+	// nothing changed since the last fetch
+	if response.StatusCode == http.StatusNotModified {
+		return nil
 	}
 
-	req, err := http.NewRequest("GET", rss.Link, nil)
+	err = callback(rss, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
 
-	// NOTE this !! - close the request
-	req.Close = true
+	rss.Feed.Lock()
+	rss.FeedLnk.SetValidators(response.Header.Get("ETag"), response.Header.Get("Last-Modified"))
+	rss.Feed.Unlock()
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Fedora; Linux x86_64; rv:64.0) Gecko/20100101 Firefox/64.0")
+	return nil
+}
+
+// fetchFeed - the answer and body of the feed. The connection to the host
+// is held only while the body is read, not while the items are saved.
+func fetchFeed(rss *rssSource, client *fetchClient, req *http.Request) (*http.Response, []byte, error) {
+	release, err := hostLimits.Acquire(rss.Link, rss.hostPolicy())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	startTime := time.Now()
 
 	response, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	defer response.Body.Close()
 
-	err = callback(rss, response.Body)
+	rss.latency = time.Since(startTime)
+	rss.httpStatus = response.StatusCode
+
+	if err = checkRetryAfter(rss.Link, response); err != nil {
+		return nil, nil, err
+	}
+
+	if response.StatusCode >= 400 {
+		return nil, nil, fmt.Errorf("%s answered %s", rss.Link, response.Status)
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return response, body, nil
+}
+
+func parseXMLSource(rss *rssSource, source io.Reader) error {
+	feed, err := decodeFeed(rss, source)
+	if err != nil {
+		return err
+	}
+
+	rss.itemCount = len(feed.Rss)
+
+	err = saveFeed(feed)
 	if err != nil {
 		return err
 	}
 
+	rss.newItems = len(feed.Inserted)
+
+	notifyAlerts(feed.Alerts)
+	publishItems(feed)
+
+	if rss.FetchFullText || rss.DownloadEnclosures {
+		downloads.forgetOld()
+	}
+
+	if rss.FetchFullText {
+		if err = queueFullText(rss, feed.Inserted); err != nil {
+			return err
+		}
+
+		if err = backfillFullText(rss, feed.SourceID); err != nil {
+			return err
+		}
+	}
+
+	if rss.DownloadEnclosures {
+		if err = queueEnclosures(rss, feed.Inserted); err != nil {
+			return err
+		}
+
+		if err = backfillEnclosures(rss, feed.SourceID); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func parseXMLSource(rss *rssSource, source io.Reader) error {
+// decodeFeed - read the RSS 2.0 / Atom feed of the source
+func decodeFeed(rss *rssSource, source io.Reader) (*RssFeed, error) {
 	decoder := xml.NewDecoder(source)
 	decoder.CharsetReader = charset.NewReaderLabel
 
@@ -283,6 +438,7 @@ func parseXMLSource(rss *rssSource, source io.Reader) error {
 	feed.Link = rss.Link
 	feed.Feed = rss.Feed
 	feed.FeedLink = rss.FeedLnk
+	feed.UpdateInPlace = config.UpdateInPlace || rss.UpdateInPlace
 
 	for {
 		t, err := decoder.Token()
@@ -290,12 +446,19 @@ func parseXMLSource(rss *rssSource, source io.Reader) error {
 			break
 		}
 		if err != nil && err != io.EOF {
-			return err
+			return nil, err
 		}
 
 		switch se := t.(type) {
 		case xml.StartElement:
 			switch se.Name.Local {
+			case "feed":
+				// Atom 1.0 - the root element holds the whole feed
+				var atom AtomFeed
+				if err := decoder.DecodeElement(&atom, &se); err != nil {
+					return nil, err
+				}
+				atom.FillRssFeed(&feed)
 			case "title":
 				decoder.DecodeElement(&feed.Title, &se)
 			case "description":
@@ -326,6 +489,10 @@ func parseXMLSource(rss *rssSource, source io.Reader) error {
 		}
 	}
 
+	return &feed, nil
+}
+
+func saveFeed(feed *RssFeed) error {
 	rssLock.Lock()
 	defer rssLock.Unlock()
 
@@ -340,6 +507,11 @@ func parseXMLSource(rss *rssSource, source io.Reader) error {
 		return err
 	}
 
+	err = feed.clusterStories(tx)
+	if err != nil {
+		return err
+	}
+
 	dbutl.Commit(tx)
 
 	return nil
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertRule - rule matched against every new rss item
+type alertRule struct {
+	Name      string   `json:"Name"`
+	Keywords  []string `json:"Keywords"`
+	Regexes   []string `json:"Regexes"`
+	Sources   []string `json:"Sources"`
+	Languages []string `json:"Languages"`
+	Notifiers []string `json:"Notifiers"`
+	regexes   []*regexp.Regexp
+}
+
+// notifierConfig - where the alerts are delivered
+type notifierConfig struct {
+	Name     string            `json:"Name"`
+	Type     string            `json:"Type"`
+	URL      string            `json:"URL"`
+	Headers  map[string]string `json:"Headers"`
+	Path     string            `json:"Path"`
+	Host     string            `json:"Host"`
+	Port     int               `json:"Port"`
+	User     string            `json:"User"`
+	Password string            `json:"Password"`
+	From     string            `json:"From"`
+	To       []string          `json:"To"`
+}
+
+// rssAlert - match of an alert rule
+type rssAlert struct {
+	RssID    int64     `json:"rss_id"`
+	Rule     string    `json:"rule"`
+	Matched  string    `json:"matched"`
+	Source   string    `json:"source"`
+	Language string    `json:"language"`
+	Title    string    `json:"title"`
+	Link     string    `json:"link"`
+	RssDate  time.Time `json:"rss_date"`
+	notify   []string
+}
+
+// Notifier - delivers alerts
+type Notifier interface {
+	Notify(alert *rssAlert) error
+}
+
+var notifiers = make(map[string]Notifier)
+
+// prepareAlerts - compile the rules and create the notifiers
+func prepareAlerts() error {
+	for _, cfg := range config.Notifiers {
+		n, err := newNotifier(cfg)
+		if err != nil {
+			return err
+		}
+
+		notifiers[cfg.Name] = n
+	}
+
+	for i := range config.AlertRules {
+		rule := &config.AlertRules[i]
+
+		for _, expr := range rule.Regexes {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("alert rule %s: %v", rule.Name, err)
+			}
+
+			rule.regexes = append(rule.regexes, re)
+		}
+
+		for _, name := range rule.Notifiers {
+			if _, ok := notifiers[name]; !ok {
+				return fmt.Errorf("alert rule %s: unknown notifier %s", rule.Name, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func newNotifier(cfg notifierConfig) (Notifier, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "webhook":
+		return &webhookNotifier{URL: cfg.URL, Headers: cfg.Headers}, nil
+	case "smtp":
+		port := cfg.Port
+		if port <= 0 {
+			port = 25
+		}
+
+		return &smtpNotifier{
+			Addr:     fmt.Sprintf("%s:%d", cfg.Host, port),
+			Host:     cfg.Host,
+			User:     cfg.User,
+			Password: cfg.Password,
+			From:     cfg.From,
+			To:       cfg.To,
+		}, nil
+	case "file":
+		return &fileNotifier{Path: cfg.Path}, nil
+	}
+
+	return nil, fmt.Errorf("notifier %s: unknown type %s", cfg.Name, cfg.Type)
+}
+
+// hasSource - the source is one of the list (case insensitive)
+func hasSource(source string, list []string) bool {
+	for _, elem := range list {
+		if strings.EqualFold(strings.TrimSpace(elem), source) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesAny - the value starts with one of the list, so "en" matches
+// the "en-us" language tags
+func matchesAny(value string, list []string) bool {
+	for _, elem := range list {
+		if strings.HasPrefix(value, strings.ToLower(elem)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match - what matched the rule in the item (empty if nothing)
+func (a *alertRule) match(source string, lang string, rss *RssItem) string {
+	if len(a.Sources) > 0 && !hasSource(source, a.Sources) {
+		return ""
+	}
+
+	if len(a.Languages) > 0 && !matchesAny(strings.ToLower(lang), a.Languages) {
+		return ""
+	}
+
+	text := strings.Join([]string{rss.Title, rss.Description, rss.Content}, "\n")
+	lowered := strings.ToLower(text)
+
+	for _, keyword := range a.Keywords {
+		if strings.Contains(lowered, strings.ToLower(keyword)) {
+			return keyword
+		}
+	}
+
+	for _, re := range a.regexes {
+		if m := re.FindString(text); len(m) > 0 {
+			return m
+		}
+	}
+
+	return ""
+}
+
+// checkAlerts - evaluate the rules against the inserted item
+func (r *RssFeed) checkAlerts(tx *sql.Tx, rss *RssItem) error {
+	for i := range config.AlertRules {
+		rule := &config.AlertRules[i]
+
+		lang := itemLanguage(rss.DetectedLanguage, r.Language)
+
+		matched := rule.match(r.Source, lang, rss)
+		if len(matched) == 0 {
+			continue
+		}
+
+		alert := rssAlert{
+			RssID:    rss.RssID,
+			Rule:     rule.Name,
+			Matched:  matched,
+			Source:   r.Source,
+			Language: lang,
+			Title:    strings.TrimSpace(rss.Title),
+			Link:     strings.TrimSpace(rss.Link),
+			RssDate:  rss.RssDate,
+			notify:   rule.Notifiers,
+		}
+
+		pq := dbutl.PQuery(`
+			INSERT INTO rss_alert (
+				rss_id,
+				rule_name,
+				matched,
+				add_date
+			)
+			VALUES (?, ?, ?, ?)
+		`, alert.RssID,
+			alert.Rule,
+			alert.Matched,
+			time.Now().UTC())
+
+		// items not stored in the database only get notified
+		if alert.RssID > 0 {
+			_, err := dbutl.ExecTx(tx, pq)
+			if err != nil {
+				return err
+			}
+		}
+
+		r.Alerts = append(r.Alerts, &alert)
+	}
+
+	return nil
+}
+
+// notifyAlerts - deliver the alerts (after they were saved)
+func notifyAlerts(alerts []*rssAlert) {
+	for _, alert := range alerts {
+		delivered := true
+
+		for _, name := range alert.notify {
+			if err := notifiers[name].Notify(alert); err != nil {
+				delivered = false
+
+				audit.Log(err,
+					"rss alert",
+					"notify failed",
+					"notifier", name,
+					"rule", alert.Rule,
+					"rss_id", alert.RssID)
+			}
+		}
+
+		if !delivered || len(alert.notify) == 0 || alert.RssID == 0 {
+			continue
+		}
+
+		pq := dbutl.PQuery(`
+			UPDATE rss_alert
+			   SET notified = 1
+			 WHERE rss_id = ?
+			   AND rule_name = ?
+		`, alert.RssID,
+			alert.Rule)
+
+		if _, err := dbutl.Exec(pq); err != nil {
+			audit.Log(err, "rss alert", "update failed", "rule", alert.Rule, "rss_id", alert.RssID)
+		}
+	}
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// postJSON - POST v as JSON to the url
+func postJSON(url string, headers map[string]string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	response, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", url, response.Status)
+	}
+
+	return nil
+}
+
+// webhookNotifier - POST the alert as JSON
+type webhookNotifier struct {
+	URL     string
+	Headers map[string]string
+}
+
+// Notify - Notifier
+func (n *webhookNotifier) Notify(alert *rssAlert) error {
+	return postJSON(n.URL, n.Headers, alert)
+}
+
+// smtpNotifier - mail the alert
+type smtpNotifier struct {
+	Addr     string
+	Host     string
+	User     string
+	Password string
+	From     string
+	To       []string
+}
+
+// Notify - Notifier
+func (n *smtpNotifier) Notify(alert *rssAlert) error {
+	var auth smtp.Auth
+	if len(n.User) > 0 {
+		auth = smtp.PlainAuth("", n.User, n.Password, n.Host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mailSubject(fmt.Sprintf("[%s] %s: %s", appName, alert.Rule, alert.Title)))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n%s\r\n\r\n", alert.Title, alert.Link)
+	fmt.Fprintf(&msg, "Source: %s\r\nDate: %s\r\nMatched: %s\r\n",
+		alert.Source,
+		alert.RssDate.UTC().Format(time.RFC1123Z),
+		alert.Matched)
+
+	return smtp.SendMail(n.Addr, auth, n.From, n.To, msg.Bytes())
+}
+
+// mailSubject - the subject on one line, encoded if it is not plain ASCII
+// (the titles come from the feeds: a line break would add headers)
+func mailSubject(subject string) string {
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	return mime.QEncoding.Encode("utf-8", subject)
+}
+
+// fileNotifier - append the alert as a JSON line
+type fileNotifier struct {
+	sync.Mutex
+	Path string
+}
+
+// Notify - Notifier
+func (n *fileNotifier) Notify(alert *rssAlert) error {
+	line, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+
+	return err
+}
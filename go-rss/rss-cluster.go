@@ -0,0 +1,205 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/geo-stanciu/go-utils/utils"
+)
+
+// The same story published by several sources is grouped in a cluster:
+// each inserted item is compared with the items of the other sources
+// dated within ClusterWindowHours of it, by the Jaccard similarity of the
+// word pairs (shingles) of their title and description. The item joins the
+// cluster of the most similar one above ClusterThreshold, else it starts a
+// new cluster. rss.cluster_id is the rss_id of the first item of the story.
+
+const (
+	defaultClusterWindowHours = 24
+	defaultClusterThreshold   = 0.4
+	maxStoryWords             = 50
+)
+
+// diacritics folded, as some feeds publish the text without them
+var foldLetters = strings.NewReplacer(
+	"ă", "a", "â", "a", "î", "i", "ș", "s", "ş", "s", "ț", "t", "ţ", "t",
+	"é", "e", "è", "e", "ê", "e", "à", "a", "ç", "c", "ö", "o", "ő", "o",
+	"ü", "u", "ű", "u", "ä", "a", "á", "a", "í", "i", "ó", "o", "ú", "u",
+	"ñ", "n", "ß", "ss",
+)
+
+// storyItem - stored item compared with the inserted ones
+type storyItem struct {
+	RssID       int64     `sql:"rss_id"`
+	ClusterID   int64     `sql:"cluster_id"`
+	SourceID    int       `sql:"rss_source_id"`
+	Title       string    `sql:"title"`
+	Description string    `sql:"description"`
+	RssDate     time.Time `sql:"rss_date"`
+	shingles    map[string]bool
+}
+
+func clusterWindow() time.Duration {
+	hours := config.ClusterWindowHours
+	if hours == 0 {
+		hours = defaultClusterWindowHours
+	}
+
+	return time.Duration(hours) * time.Hour
+}
+
+func clusterThreshold() float64 {
+	if config.ClusterThreshold > 0 {
+		return config.ClusterThreshold
+	}
+
+	return defaultClusterThreshold
+}
+
+// storyShingles - the pairs of consecutive significant words of the text
+func storyShingles(title string, description string) map[string]bool {
+	text := strings.ToLower(title + "\n" + stripTags(description))
+
+	var words []string
+
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if isStopWord(w) {
+			continue
+		}
+
+		words = append(words, foldLetters.Replace(w))
+
+		if len(words) == maxStoryWords {
+			break
+		}
+	}
+
+	shingles := make(map[string]bool)
+
+	if len(words) == 1 {
+		shingles[words[0]] = true
+	}
+
+	for i := 1; i < len(words); i++ {
+		shingles[words[i-1]+" "+words[i]] = true
+	}
+
+	return shingles
+}
+
+func isStopWord(w string) bool {
+	for _, set := range stopWordSets {
+		if set[w] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jaccard - size of the intersection over the size of the union
+func jaccard(a map[string]bool, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	common := 0
+	for s := range a {
+		if b[s] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// clusterStories - set the cluster of the items inserted by Save
+// (a negative ClusterWindowHours turns the clustering off)
+func (r *RssFeed) clusterStories(tx *sql.Tx) error {
+	if config.ClusterWindowHours < 0 || len(r.Inserted) == 0 || !storeInDatabase() {
+		return nil
+	}
+
+	window := clusterWindow()
+	threshold := clusterThreshold()
+
+	from := r.Inserted[0].RssDate
+	to := from
+
+	for _, rss := range r.Inserted {
+		if rss.RssDate.Before(from) {
+			from = rss.RssDate
+		}
+		if rss.RssDate.After(to) {
+			to = rss.RssDate
+		}
+	}
+
+	pq := dbutl.PQuery(`
+		SELECT rss_id,
+		       coalesce(cluster_id, rss_id) cluster_id,
+		       rss_source_id,
+		       title,
+		       coalesce(description, '') description,
+		       rss_date
+		  FROM rss
+		 WHERE rss_source_id <> ?
+		   AND rss_date >= ?
+		   AND rss_date <= ?
+	`, r.SourceID,
+		from.Add(-window).UTC(),
+		to.Add(window).UTC())
+
+	var candidates []*storyItem
+
+	err := dbutl.ForEachRowTx(tx, pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		item := storyItem{}
+		if err := sc.Scan(dbutl, row, &item); err != nil {
+			return err
+		}
+
+		item.shingles = storyShingles(item.Title, item.Description)
+		candidates = append(candidates, &item)
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, rss := range r.Inserted {
+		shingles := storyShingles(rss.Title, rss.Description)
+		clusterID := rss.RssID
+		best := threshold
+
+		for _, c := range candidates {
+			d := c.RssDate.Sub(rss.RssDate)
+			if d > window || d < -window {
+				continue
+			}
+
+			if sim := jaccard(shingles, c.shingles); sim >= best {
+				best = sim
+				clusterID = c.ClusterID
+			}
+		}
+
+		pq = dbutl.PQuery(`
+			UPDATE rss
+			   SET cluster_id = ?
+			 WHERE rss_id = ?
+		`, clusterID,
+			rss.RssID)
+
+		if _, err = dbutl.ExecTx(tx, pq); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
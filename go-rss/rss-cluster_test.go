@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStoryShingles(t *testing.T) {
+	tests := []struct {
+		title       string
+		description string
+		want        []string
+	}{
+		{"", "", nil},
+		{"The and of", "", nil},
+		{"Brexit", "", []string{"brexit"}},
+		{"Guvernul a aprobat bugetul", "", []string{"guvernul aprobat", "aprobat bugetul"}},
+		{"Ședința Guvernului", "", []string{"sedinta guvernului"}},
+		{"Şedinţa guvernului", "", []string{"sedinta guvernului"}},
+		{"", "<p>Prime <b>minister</b> resigns</p>", []string{"prime minister", "minister resigns"}},
+		{"Budget 2024", "approved", []string{"budget 2024", "2024 approved"}},
+	}
+
+	for _, tt := range tests {
+		want := make(map[string]bool)
+		for _, s := range tt.want {
+			want[s] = true
+		}
+
+		if got := storyShingles(tt.title, tt.description); !reflect.DeepEqual(got, want) {
+			t.Errorf("storyShingles(%q, %q) = %v, want %v", tt.title, tt.description, got, want)
+		}
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	set := func(s ...string) map[string]bool {
+		m := make(map[string]bool)
+		for _, e := range s {
+			m[e] = true
+		}
+		return m
+	}
+
+	tests := []struct {
+		name string
+		a    map[string]bool
+		b    map[string]bool
+		want float64
+	}{
+		{"empty", set(), set("a b"), 0},
+		{"disjoint", set("a b"), set("c d"), 0},
+		{"equal", set("a b", "b c"), set("b c", "a b"), 1},
+		{"one of three", set("a b", "b c"), set("b c", "c d"), 1.0 / 3},
+		{
+			"same story, longer text",
+			storyShingles("Guvernul a aprobat bugetul pe 2024 in sedinta de azi", ""),
+			storyShingles("Guvernul a aprobat bugetul pe 2024", ""),
+			3.0 / 5,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := jaccard(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: jaccard = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
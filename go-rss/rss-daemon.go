@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultPollInterval = 15 * time.Minute
+	defaultMaxBackoff   = 6 * time.Hour
+	defaultSaveInterval = 5 * time.Minute
+	// how often a disabled link is checked for the enable command
+	disabledRecheck = time.Hour
+)
+
+// Done - Report the outcome of the fetch to the daemon scheduler
+func (s *rssSource) Done(err error) {
+	if s.Result != nil {
+		s.Result <- err
+	}
+}
+
+// pollInterval - poll interval of the source (falls back on the global one)
+func (s *rssSource) pollInterval() time.Duration {
+	if s.PollIntervalSeconds > 0 {
+		return time.Duration(s.PollIntervalSeconds) * time.Second
+	}
+
+	if config.PollIntervalSeconds > 0 {
+		return time.Duration(config.PollIntervalSeconds) * time.Second
+	}
+
+	return defaultPollInterval
+}
+
+// pollJitter - random delay between 0 and the configured jitter
+func (s *rssSource) pollJitter() time.Duration {
+	jitter := s.PollJitterSeconds
+	if jitter <= 0 {
+		jitter = config.PollJitterSeconds
+	}
+
+	if jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(jitter) * int64(time.Second)))
+}
+
+// nextPoll - delay until the next fetch of the source.
+// Sources that keep failing are backed off exponentially.
+func (s *rssSource) nextPoll(failures int) time.Duration {
+	delay := s.pollInterval()
+
+	if failures > 0 {
+		maxBackoff := defaultMaxBackoff
+		if config.MaxBackoffSeconds > 0 {
+			maxBackoff = time.Duration(config.MaxBackoffSeconds) * time.Second
+		}
+
+		for i := 0; i < failures && delay < maxBackoff; i++ {
+			delay *= 2
+		}
+
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+
+	return delay + s.pollJitter()
+}
+
+// runDaemon - poll the sources until SIGINT / SIGTERM
+func runDaemon(sources []rssSource) {
+	var schedulers sync.WaitGroup
+
+	rand.Seed(time.Now().UnixNano())
+
+	stop := make(chan struct{})
+
+	for _, rss := range sources {
+		schedulers.Add(1)
+		go pollRSS(rss, stop, &schedulers)
+	}
+
+	audit.Log(nil, "gather rss", "Daemon started.", "sources", len(sources))
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	saveInterval := defaultSaveInterval
+	if config.SaveIntervalSeconds > 0 {
+		saveInterval = time.Duration(config.SaveIntervalSeconds) * time.Second
+	}
+
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			saveGatherResults()
+		case sig := <-sigs:
+			audit.Log(nil, "gather rss", "Stopping daemon...", "signal", sig.String())
+			running = false
+		}
+	}
+
+	close(stop)
+
+	// let the fetches in progress finish
+	schedulers.Wait()
+
+	saveGatherResults()
+
+	audit.Log(nil, "gather rss", "Daemon stopped.")
+}
+
+// waitEnabled - wait for the disabled link to be enabled by the enable
+// command (false if the daemon stops first)
+func (s *rssSource) waitEnabled(stop chan struct{}) bool {
+	for s.isDisabled() {
+		select {
+		case <-time.After(disabledRecheck):
+		case <-stop:
+			return false
+		}
+
+		if err := s.reloadDisabled(); err != nil {
+			audit.Log(err, "feed health", "reload disabled link", "source", s.SourceName, "link", s.Link)
+		}
+	}
+
+	audit.Log(nil, "feed health", "link enabled, polled again", "source", s.SourceName, "link", s.Link)
+
+	return true
+}
+
+// pollRSS - queue the source for the rss readers at its poll interval
+func pollRSS(rss rssSource, stop chan struct{}, schedulers *sync.WaitGroup) {
+	defer schedulers.Done()
+
+	rss.Result = make(chan error, 1)
+	failures := 0
+
+	// spread the first fetches
+	delay := rss.pollJitter()
+
+	for {
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return
+		}
+
+		select {
+		case queue <- rss:
+		case <-stop:
+			return
+		}
+
+		err := <-rss.Result
+
+		// a host blocked by its Retry-After was not asked, it did not fail
+		var retry *retryAfterError
+		blocked := errors.As(err, &retry) && retry.Blocked
+
+		if err == nil {
+			failures = 0
+		} else if !blocked {
+			failures++
+		}
+
+		// failed for too long, until enabled again
+		if rss.isDisabled() {
+			if !rss.waitEnabled(stop) {
+				return
+			}
+
+			failures = 0
+			delay = rss.pollJitter()
+			continue
+		}
+
+		delay = rss.nextPoll(failures)
+
+		// the host asked for a longer pause
+		if retry != nil && retry.Delay > delay {
+			delay = retry.Delay
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// query parameters added by trackers, ignored when comparing links
+var trackingParams = []string{
+	"utm_",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"yclid",
+	"msclkid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+	"_hsenc",
+	"_hsmi",
+	"ref_src",
+	"cmpid",
+	"ncid",
+	"at_medium",
+	"at_campaign",
+}
+
+func isTrackingParam(param string) bool {
+	param = strings.ToLower(param)
+
+	for _, p := range trackingParams {
+		if strings.HasSuffix(p, "_") {
+			if strings.HasPrefix(param, p) {
+				return true
+			}
+		} else if param == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeLink - link without tracking params, fragment and default port
+func normalizeLink(link string) string {
+	link = strings.TrimSpace(link)
+
+	u, err := url.Parse(link)
+	if err != nil || len(u.Host) == 0 {
+		return link
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Host = strings.TrimSuffix(u.Host, ":80")
+	u.Host = strings.TrimSuffix(u.Host, ":443")
+	u.Fragment = ""
+
+	query := u.Query()
+	for param := range query {
+		if isTrackingParam(param) {
+			query.Del(param)
+		}
+	}
+	// Encode sorts the params by key
+	u.RawQuery = query.Encode()
+
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+	}
+	u.RawPath = ""
+
+	return u.String()
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// dedupeKey - identity of the item inside its source:
+// the guid when present, else the normalized link, else the content hash
+func (rss *RssItem) dedupeKey() string {
+	if guid := strings.TrimSpace(rss.ItemGUID); len(guid) > 0 {
+		return sha256Hex("guid:" + guid)
+	}
+
+	if link := normalizeLink(rss.Link); len(link) > 0 {
+		return sha256Hex("link:" + link)
+	}
+
+	return sha256Hex("hash:" + rss.contentHash())
+}
+
+// contentHash - hash of the item content, used to detect edited items
+func (rss *RssItem) contentHash() string {
+	return sha256Hex(strings.Join([]string{
+		strings.TrimSpace(rss.Title),
+		strings.TrimSpace(rss.Description),
+		strings.TrimSpace(rss.Content),
+		strings.TrimSpace(rss.Link),
+	}, "\x00"))
+}
+
+type storedRss struct {
+	RssID       int64  `sql:"rss_id"`
+	ContentHash string `sql:"content_hash"`
+}
+
+// findRss - id and content hash of the stored item (0 if not found).
+// Items saved before item_key existed are matched by title and link
+// and get their key filled in.
+func (r *RssFeed) findRss(tx *sql.Tx, rss *RssItem) (int64, string, error) {
+	stored := storedRss{}
+
+	pq := dbutl.PQuery(`
+		SELECT rss_id,
+		       coalesce(content_hash, '') content_hash
+		  FROM rss
+		 WHERE rss_source_id = ?
+		   AND item_key = ?
+	`, r.SourceID,
+		rss.ItemKey)
+
+	err := dbutl.RunQueryTx(tx, pq, &stored)
+	if err == nil {
+		return stored.RssID, stored.ContentHash, nil
+	} else if err != sql.ErrNoRows {
+		return 0, "", err
+	}
+
+	pq = dbutl.PQuery(`
+		SELECT rss_id,
+		       coalesce(content_hash, '') content_hash
+		  FROM rss
+		 WHERE rss_source_id = ?
+		   AND item_key IS NULL
+		   AND title = ?
+		   AND link = ?
+	`, r.SourceID,
+		strings.TrimSpace(rss.Title),
+		strings.TrimSpace(rss.Link))
+
+	err = dbutl.RunQueryTx(tx, pq, &stored)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	pq = dbutl.PQuery(`
+		UPDATE rss
+		   SET item_key = ?,
+		       content_hash = ?
+		 WHERE rss_id = ?
+	`, rss.ItemKey,
+		rss.ContentHash,
+		stored.RssID)
+
+	_, err = dbutl.ExecTx(tx, pq)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return stored.RssID, rss.ContentHash, nil
+}
+
+// updateRss - refresh the stored item with the current content
+func (r *RssFeed) updateRss(tx *sql.Tx, rssID int64, rss *RssItem) error {
+	pq := dbutl.PQuery(`
+		UPDATE rss
+		   SET title = ?,
+		       link = ?,
+		       description = ?,
+		       item_guid = ?,
+		       orig_link = ?,
+		       category = ?,
+		       subcategory = ?,
+		       content = ?,
+		       keywords = ?,
+		       tags = ?,
+		       creator = ?,
+		       enclosure_link = ?,
+		       enclosure_length = ?,
+		       enclosure_filetype = ?,
+		       media_link = ?,
+		       media_filetype = ?,
+		       media_thumbnail = ?,
+		       content_hash = ?,
+		       detected_language = ?,
+		       update_date = ?
+		 WHERE rss_id = ?
+	`, strings.TrimSpace(rss.Title),
+		strings.TrimSpace(rss.Link),
+		strings.TrimSpace(rss.Description),
+		strings.TrimSpace(rss.ItemGUID),
+		strings.TrimSpace(rss.OrigLink),
+		strings.TrimSpace(rss.Category),
+		strings.TrimSpace(rss.SubCategory),
+		strings.TrimSpace(rss.Content),
+		strings.TrimSpace(rss.Keywords),
+		strings.TrimSpace(rss.Tags),
+		strings.TrimSpace(rss.Creator),
+		strings.TrimSpace(rss.Enclosure.URL),
+		rss.Enclosure.Length,
+		rss.Enclosure.Type,
+		strings.TrimSpace(rss.MediaContent.URL),
+		rss.MediaContent.Type,
+		strings.TrimSpace(rss.Thumbnail.URL),
+		rss.ContentHash,
+		nullString(rss.DetectedLanguage),
+		time.Now().UTC(),
+		rssID)
+
+	_, err := dbutl.ExecTx(tx, pq)
+	if err != nil {
+		return err
+	}
+
+	audit.Log(nil,
+		"update rss",
+		"item changed",
+		"source", r.Source,
+		"rss_id", rssID,
+		"link", strings.TrimSpace(rss.Link))
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeLink(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"", ""},
+		{"not a link", "not a link"},
+		{" https://example.com/news/1 ", "https://example.com/news/1"},
+		{"HTTPS://Example.COM/News/1", "https://example.com/News/1"},
+		{"http://example.com:80/news/1", "http://example.com/news/1"},
+		{"https://example.com:443/news/1", "https://example.com/news/1"},
+		{"https://example.com:8443/news/1", "https://example.com:8443/news/1"},
+		{"https://example.com/news/1/", "https://example.com/news/1"},
+		{"https://example.com/", "https://example.com/"},
+		{"https://example.com/news/1#comments", "https://example.com/news/1"},
+		{"https://example.com/news?id=1&page=2", "https://example.com/news?id=1&page=2"},
+		{"https://example.com/news?page=2&id=1", "https://example.com/news?id=1&page=2"},
+		{"https://example.com/news/1?utm_source=rss&utm_Medium=feed", "https://example.com/news/1"},
+		{"https://example.com/news?id=1&fbclid=abc&gclid=def", "https://example.com/news?id=1"},
+		{"https://example.com/news/1?ref=rss", "https://example.com/news/1?ref=rss"},
+		{"https://example.com/news/1?ref_src=twsrc", "https://example.com/news/1"},
+		{"https://example.com/news?utm=1", "https://example.com/news?utm=1"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeLink(tt.link); got != tt.want {
+			t.Errorf("normalizeLink(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestDedupeKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a    RssItem
+		b    RssItem
+		same bool
+	}{
+		{
+			name: "same guid, other links",
+			a:    RssItem{ItemGUID: "urn:1", Link: "https://example.com/a"},
+			b:    RssItem{ItemGUID: " urn:1 ", Link: "https://example.com/b"},
+			same: true,
+		},
+		{
+			name: "other guids, same link",
+			a:    RssItem{ItemGUID: "urn:1", Link: "https://example.com/a"},
+			b:    RssItem{ItemGUID: "urn:2", Link: "https://example.com/a"},
+			same: false,
+		},
+		{
+			name: "links equal once normalized",
+			a:    RssItem{Link: "https://example.com/a?utm_source=rss"},
+			b:    RssItem{Link: "HTTPS://EXAMPLE.COM/a/#top"},
+			same: true,
+		},
+		{
+			name: "other links",
+			a:    RssItem{Link: "https://example.com/a?id=1"},
+			b:    RssItem{Link: "https://example.com/a?id=2"},
+			same: false,
+		},
+		{
+			name: "guid and link with the same text",
+			a:    RssItem{ItemGUID: "https://example.com/a"},
+			b:    RssItem{Link: "https://example.com/a"},
+			same: false,
+		},
+		{
+			name: "no guid nor link, same content",
+			a:    RssItem{Title: "Title", Description: "text"},
+			b:    RssItem{Title: " Title ", Description: "text"},
+			same: true,
+		},
+		{
+			name: "no guid nor link, other content",
+			a:    RssItem{Title: "Title", Description: "text"},
+			b:    RssItem{Title: "Title", Description: "edited text"},
+			same: false,
+		},
+	}
+
+	for _, tt := range tests {
+		if same := tt.a.dedupeKey() == tt.b.dedupeKey(); same != tt.same {
+			t.Errorf("%s: same key = %v, want %v", tt.name, same, tt.same)
+		}
+	}
+}
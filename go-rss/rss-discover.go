@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// paths where sites usually publish their feeds
+var commonFeedPaths = []string{
+	"/feed",
+	"/rss",
+	"/rss.xml",
+	"/feed.xml",
+	"/atom.xml",
+	"/index.xml",
+	"/index.rss",
+	"/?feed=rss2",
+}
+
+var feedTypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/rdf+xml",
+	"application/xml",
+	"text/xml",
+}
+
+const maxDiscoverBytes = 4 << 20
+
+// feedCandidate - link that might be a feed
+type feedCandidate struct {
+	Link     string
+	Title    string
+	Language string
+	Items    int
+	Err      error
+}
+
+func discoverCommand(args []string) error {
+	fs := flag.NewFlagSet("discover", flag.ContinueOnError)
+	addPtr := fs.Bool("add", false, "append the picked feeds to rss.json")
+	pickPtr := fs.String("pick", "1", "feeds added by -add: comma separated numbers from the list, or all")
+	namePtr := fs.String("name", "", "source name of the added feeds (default the feed title)")
+	langPtr := fs.String("lang", "", "language of the added feeds (default the feed language)")
+	profilePtr := fs.String("profile", "", "HTTP profile used to fetch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: discover [flags] <url>")
+	}
+
+	page := strings.TrimSpace(fs.Arg(0))
+	if !strings.Contains(page, "://") {
+		page = "https://" + page
+	}
+
+	client, err := getFetchClient(*profilePtr, false)
+	if err != nil {
+		return err
+	}
+
+	links, err := discoverFeeds(client, page)
+	if err != nil {
+		return err
+	}
+
+	var found []*feedCandidate
+
+	for _, link := range links {
+		c := validateFeed(client, link)
+		if c.Err != nil {
+			continue
+		}
+
+		found = append(found, c)
+		fmt.Printf("%3d. %s\n     %s (%s, %d items)\n", len(found), c.Link, c.Title, c.Language, c.Items)
+	}
+
+	if len(found) == 0 {
+		return fmt.Errorf("no feed found for %s", page)
+	}
+
+	if !*addPtr {
+		return nil
+	}
+
+	picked, err := pickCandidates(found, *pickPtr)
+	if err != nil {
+		return err
+	}
+
+	var added []string
+
+	for _, c := range picked {
+		name := strings.TrimSpace(*namePtr)
+		if len(name) == 0 {
+			name = c.Title
+		}
+
+		lang := strings.TrimSpace(*langPtr)
+		if len(lang) == 0 {
+			lang = c.Language
+		}
+
+		if config.addSourceLink(name, strings.ToUpper(lang), c.Link) {
+			added = append(added, c.Link)
+		}
+	}
+
+	if len(added) > 0 {
+		if err = config.rssSources.SaveToFile(rssSourcesFile()); err != nil {
+			return err
+		}
+	}
+
+	audit.Log(nil,
+		"discover",
+		"Feeds added.",
+		"page", page,
+		"links", strings.Join(added, " "))
+
+	return nil
+}
+
+// addSourceLink - add the link to the source with the name, creating it if needed
+// (false if any source already has the link, so it is not fetched twice)
+func (c *configuration) addSourceLink(name string, lang string, link string) bool {
+	if c.findLink(link) != nil {
+		return false
+	}
+
+	rss := c.getSource(name)
+	if rss == nil {
+		if len(lang) == 0 {
+			lang = "EN"
+		}
+
+		c.Rss = append(c.Rss, rssSource{
+			SourceName: name,
+			Lang:       lang,
+			Link:       link,
+		})
+
+		return true
+	}
+
+	rss.Links = append(rss.Links, link)
+
+	return true
+}
+
+func pickCandidates(found []*feedCandidate, pick string) ([]*feedCandidate, error) {
+	if strings.EqualFold(strings.TrimSpace(pick), "all") {
+		return found, nil
+	}
+
+	var picked []*feedCandidate
+
+	for _, elem := range strings.Split(pick, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(elem))
+		if err != nil || i < 1 || i > len(found) {
+			return nil, fmt.Errorf("invalid pick: %s", elem)
+		}
+
+		picked = append(picked, found[i-1])
+	}
+
+	return picked, nil
+}
+
+// fetchBody - the body of the link (at most maxDiscoverBytes)
+func fetchBody(client *fetchClient, link string) ([]byte, string, error) {
+	req, err := client.newRequest(link)
+	if err != nil {
+		return nil, "", err
+	}
+
+	release, err := hostLimits.Acquire(link, (&rssSource{}).hostPolicy())
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+
+	if err = checkRetryAfter(link, response); err != nil {
+		return nil, "", err
+	}
+
+	if response.StatusCode >= 400 {
+		return nil, "", fmt.Errorf("%s answered %s", link, response.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxDiscoverBytes))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, response.Header.Get("Content-Type"), nil
+}
+
+// discoverFeeds - candidate feed links for the page: the page itself,
+// the alternate links it declares and the common feed paths of the site
+func discoverFeeds(client *fetchClient, page string) ([]string, error) {
+	base, err := url.Parse(page)
+	if err != nil {
+		return nil, err
+	}
+
+	links := []string{page}
+
+	body, contentType, err := fetchBody(client, page)
+	if err != nil {
+		return nil, err
+	}
+
+	if r, err := charset.NewReader(bytes.NewReader(body), contentType); err == nil {
+		if doc, err := html.Parse(r); err == nil {
+			for _, href := range alternateLinks(doc) {
+				if u, err := base.Parse(href); err == nil {
+					links = append(links, u.String())
+				}
+			}
+		}
+	}
+
+	root := &url.URL{Scheme: base.Scheme, Host: base.Host}
+
+	for _, path := range commonFeedPaths {
+		if u, err := root.Parse(path); err == nil {
+			links = append(links, u.String())
+		}
+	}
+
+	// without duplicates
+	var list []string
+	seen := make(map[string]bool)
+
+	for _, link := range links {
+		key := normalizeLink(link)
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		list = append(list, link)
+	}
+
+	return list, nil
+}
+
+// alternateLinks - href of the <link rel="alternate"> tags of a feed type
+func alternateLinks(doc *html.Node) []string {
+	var links []string
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Link {
+			rel := strings.ToLower(attr(n, "rel"))
+			typ := strings.ToLower(strings.TrimSpace(attr(n, "type")))
+			href := strings.TrimSpace(attr(n, "href"))
+
+			if strings.Contains(rel, "alternate") && len(href) > 0 && isFeedType(typ) {
+				links = append(links, href)
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return links
+}
+
+func isFeedType(typ string) bool {
+	for _, t := range feedTypes {
+		if strings.HasPrefix(typ, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateFeed - read the link with the feed parser, without saving anything
+func validateFeed(client *fetchClient, link string) *feedCandidate {
+	c := &feedCandidate{Link: link}
+
+	body, _, err := fetchBody(client, link)
+	if err != nil {
+		c.Err = err
+		return c
+	}
+
+	feed, err := decodeFeed(&rssSource{Link: link}, bytes.NewReader(body))
+	if err != nil {
+		c.Err = err
+		return c
+	}
+
+	// the decoder stops at the first error, a page that is not a feed has no items
+	if len(feed.Rss) == 0 {
+		c.Err = fmt.Errorf("%s: no items", link)
+		return c
+	}
+
+	c.Title = strings.TrimSpace(feed.Title)
+	if len(c.Title) == 0 {
+		c.Title = link
+	}
+
+	c.Language = strings.TrimSpace(feed.Language)
+	if i := strings.IndexAny(c.Language, "-_"); i > 0 {
+		c.Language = c.Language[:i]
+	}
+
+	c.Items = len(feed.Rss)
+
+	return c
+}
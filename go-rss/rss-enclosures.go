@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/geo-stanciu/go-utils/utils"
+)
+
+// The enclosures, media contents and thumbnails of the new items of the
+// sources with DownloadEnclosures set are saved by the download pool in a
+// content-addressed store: EnclosureDir/<2 hex>/<2 hex>/<sha256><ext>,
+// so a file linked by many items is kept once. rss_enclosure records
+// what was saved for each item; the items linking files and without a
+// rss_enclosure row (a full queue, a failed download) are queued again by
+// the backfill.
+
+const defaultMaxEnclosureBytes = 50 << 20
+
+// a download may last a minute, plus the time of the size limit at the
+// slowest speed we wait for
+const (
+	minEnclosureTimeout        = time.Minute
+	minEnclosureBytesPerSecond = 64 << 10
+)
+
+// enclosureJob - file linked by an item
+type enclosureJob struct {
+	RssID    int64
+	Kind     string
+	URL      string
+	MimeType string
+}
+
+// enclosureJobs - the files linked by the item
+func (rss *RssItem) enclosureJobs() []enclosureJob {
+	var jobs []enclosureJob
+
+	add := func(kind string, link string, mimeType string) {
+		link = strings.TrimSpace(link)
+		if len(link) == 0 {
+			return
+		}
+
+		for _, job := range jobs {
+			if job.URL == link {
+				return
+			}
+		}
+
+		jobs = append(jobs, enclosureJob{
+			RssID:    rss.RssID,
+			Kind:     kind,
+			URL:      link,
+			MimeType: strings.TrimSpace(mimeType),
+		})
+	}
+
+	add("enclosure", rss.Enclosure.URL, rss.Enclosure.Type)
+	add("media", rss.MediaContent.URL, rss.MediaContent.Type)
+	add("thumbnail", rss.Thumbnail.URL, "")
+
+	return jobs
+}
+
+// allowedMimeType - the type is in EnclosureTypes ("audio/" allows all audio types)
+func allowedMimeType(mimeType string) bool {
+	if len(config.EnclosureTypes) == 0 {
+		return true
+	}
+
+	mimeType = strings.ToLower(mimeType)
+
+	for _, t := range config.EnclosureTypes {
+		t = strings.ToLower(t)
+
+		if strings.HasSuffix(t, "/") {
+			if strings.HasPrefix(mimeType, t) {
+				return true
+			}
+		} else if mimeType == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func enclosureDir() string {
+	if len(config.EnclosureDir) > 0 {
+		return config.EnclosureDir
+	}
+
+	return filepath.Join(currentDir, "enclosures")
+}
+
+func maxEnclosureBytes() int64 {
+	if config.MaxEnclosureBytes > 0 {
+		return config.MaxEnclosureBytes
+	}
+
+	return defaultMaxEnclosureBytes
+}
+
+// enclosureTimeout - deadline of a download, by the size limit
+// (the total timeout of the HTTP profile is meant for the feeds)
+func enclosureTimeout(maxBytes int64) time.Duration {
+	return minEnclosureTimeout + time.Duration(maxBytes/minEnclosureBytesPerSecond)*time.Second
+}
+
+// queueEnclosures - download the files linked by the inserted items
+func queueEnclosures(rss *rssSource, items []*RssItem) error {
+	feedClient, err := rss.httpClient()
+	if err != nil {
+		return err
+	}
+
+	client := feedClient.withoutTimeout()
+
+	for _, item := range items {
+		if item.RssID > 0 {
+			submitEnclosures(rss, client, item)
+		}
+	}
+
+	return nil
+}
+
+type enclosureItem struct {
+	RssID         int64  `sql:"rss_id"`
+	EnclosureLink string `sql:"enclosure_link"`
+	EnclosureType string `sql:"enclosure_filetype"`
+	MediaLink     string `sql:"media_link"`
+	MediaType     string `sql:"media_filetype"`
+	Thumbnail     string `sql:"media_thumbnail"`
+}
+
+// backfillEnclosures - download again the files of the items of the source
+// added in the last downloadBackfillHours that link files but have none
+// in rss_enclosure (dropped on a full download queue or failed)
+func backfillEnclosures(rss *rssSource, sourceID int) error {
+	if sourceID <= 0 {
+		return nil
+	}
+
+	pq := dbutl.PQuery(`
+		SELECT r.rss_id,
+		       coalesce(r.enclosure_link, '') enclosure_link,
+		       coalesce(r.enclosure_filetype, '') enclosure_filetype,
+		       coalesce(r.media_link, '') media_link,
+		       coalesce(r.media_filetype, '') media_filetype,
+		       coalesce(r.media_thumbnail, '') media_thumbnail
+		  FROM rss r
+		 WHERE r.rss_source_id = ?
+		   AND r.add_date >= ?
+		   AND (r.enclosure_link <> ''
+		        OR r.media_link <> ''
+		        OR r.media_thumbnail <> '')
+		   AND NOT EXISTS (
+		         SELECT 1
+		           FROM rss_enclosure e
+		          WHERE e.rss_id = r.rss_id
+		       )
+	`, sourceID,
+		time.Now().UTC().Add(-downloadBackfillHours*time.Hour))
+
+	var items []*RssItem
+
+	err := dbutl.ForEachRow(pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		e := enclosureItem{}
+		if err := sc.Scan(dbutl, row, &e); err != nil {
+			return err
+		}
+
+		item := RssItem{RssID: e.RssID}
+		item.Enclosure.URL = e.EnclosureLink
+		item.Enclosure.Type = e.EnclosureType
+		item.MediaContent.URL = e.MediaLink
+		item.MediaContent.Type = e.MediaType
+		item.Thumbnail.URL = e.Thumbnail
+
+		items = append(items, &item)
+
+		return nil
+	})
+
+	if err != nil || len(items) == 0 {
+		return err
+	}
+
+	return queueEnclosures(rss, items)
+}
+
+// submitEnclosures - queue the downloads of the files linked by the item
+// (each once, see downloadPool.Submit)
+func submitEnclosures(rss *rssSource, client *fetchClient, item *RssItem) {
+	policy := rss.hostPolicy()
+	source := rss.SourceName
+
+	for _, job := range item.enclosureJobs() {
+		job := job
+
+		// the declared type is checked again on the answer
+		if len(job.MimeType) > 0 && !allowedMimeType(job.MimeType) {
+			continue
+		}
+
+		key := fmt.Sprintf("enclosure:%d:%s", job.RssID, job.URL)
+
+		queued := downloads.Submit(key, func() {
+			err := job.download(client, policy)
+			if err != nil {
+				audit.Log(err,
+					"enclosures",
+					"download failed",
+					"source", source,
+					"rss_id", job.RssID,
+					"url", job.URL)
+			}
+		})
+
+		if !queued {
+			audit.Log(nil,
+				"enclosures",
+				"download queue full, queued again by the backfill",
+				"source", source,
+				"rss_id", job.RssID,
+				"url", job.URL)
+		}
+	}
+}
+
+// download - save the file in the store and record it in rss_enclosure
+func (job *enclosureJob) download(client *fetchClient, policy hostPolicy) error {
+	maxBytes := maxEnclosureBytes()
+
+	req, err := client.newRequest(job.URL)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), enclosureTimeout(maxBytes))
+	defer cancel()
+
+	req = req.WithContext(ctx)
+
+	release, err := hostLimits.Acquire(job.URL, policy)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err = checkRetryAfter(job.URL, response); err != nil {
+		return err
+	}
+
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("%s answered %s", job.URL, response.Status)
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type")); err == nil {
+		job.MimeType = mediaType
+	}
+
+	if !allowedMimeType(job.MimeType) {
+		return nil
+	}
+
+	if response.ContentLength > maxBytes {
+		return fmt.Errorf("%s is larger than %d bytes", job.URL, maxBytes)
+	}
+
+	dir := enclosureDir()
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(response.Body, maxBytes+1))
+	if err != nil {
+		return err
+	}
+
+	if size > maxBytes {
+		return fmt.Errorf("%s is larger than %d bytes", job.URL, maxBytes)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	contentHash := hex.EncodeToString(hash.Sum(nil))
+	relPath := filepath.Join(contentHash[:2], contentHash[2:4], contentHash+job.extension())
+	filePath := filepath.Join(dir, relPath)
+
+	if _, err = os.Stat(filePath); os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return err
+		}
+
+		if err = os.Rename(tmp.Name(), filePath); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	pq := dbutl.PQuery(`
+		INSERT INTO rss_enclosure (
+			rss_id,
+			kind,
+			url,
+			content_hash,
+			file_size,
+			mime_type,
+			file_path,
+			add_date
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.RssID,
+		job.Kind,
+		job.URL,
+		contentHash,
+		size,
+		job.MimeType,
+		filepath.ToSlash(relPath),
+		time.Now().UTC())
+
+	// writes are serialized with the feed saves
+	rssLock.Lock()
+	defer rssLock.Unlock()
+
+	_, err = dbutl.Exec(pq)
+
+	return err
+}
+
+// extension - file extension from the url, else from the mime type
+func (job *enclosureJob) extension() string {
+	if u, err := url.Parse(job.URL); err == nil {
+		ext := strings.ToLower(path.Ext(u.Path))
+		if len(ext) > 1 && len(ext) <= 6 && !unsafeFileChars.MatchString(ext[1:]) {
+			return ext
+		}
+	}
+
+	if exts, err := mime.ExtensionsByType(job.MimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+
+	return ""
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"strings"
 	"sync"
 	"time"
@@ -10,9 +11,13 @@ import (
 
 // RssLink - statistics for each rss link
 type RssLink struct {
-	Link     string
-	RssDate  time.Time
-	NewItems int
+	Link         string
+	RssDate      time.Time
+	NewItems     int
+	ETag         string `sql:"etag"`
+	LastModified string `sql:"last_modified"`
+	// the validators were changed by the last fetch and need saving
+	validatorsChanged bool
 }
 
 // RSSFeed - Last RSS items for source
@@ -42,3 +47,97 @@ func (s *RSSFeed) GetLink(lnk string) *RssLink {
 
 	return nil
 }
+
+// LoadValidators - Load the cache validators (ETag, Last-Modified)
+// saved for the link by a previous run
+func (l *RssLink) LoadValidators(sourceName string) error {
+	pq := dbutl.PQuery(`
+		SELECT coalesce(l.etag, '') etag,
+		       coalesce(l.last_modified, '') last_modified
+		  FROM rss_link l
+		  JOIN rss_source s ON (s.rss_source_id = l.rss_source_id)
+		 WHERE s.lowered_source_name = ?
+		   AND l.link = ?
+	`, strings.ToLower(sourceName),
+		l.Link)
+
+	err := dbutl.RunQuery(pq, l)
+	if err == sql.ErrNoRows {
+		// new link, saved with the results so rss_link lists every feed
+		l.validatorsChanged = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetValidators - Set the cache validators received from the server
+func (l *RssLink) SetValidators(etag string, lastModified string) {
+	if l.ETag == etag && l.LastModified == lastModified {
+		return
+	}
+
+	l.ETag = etag
+	l.LastModified = lastModified
+	l.validatorsChanged = true
+}
+
+// saveValidators - Save the cache validators (ETag, Last-Modified) of the link
+func (l *RssLink) saveValidators(tx *sql.Tx, sourceID int) error {
+	found := 0
+
+	pq := dbutl.PQuery(`
+		SELECT CASE WHEN EXISTS (
+			SELECT 1
+			  FROM rss_link
+			 WHERE rss_source_id = ?
+			   AND link = ?
+		) THEN 1 ELSE 0 END
+		FROM dual
+	`, sourceID,
+		l.Link)
+
+	err := tx.QueryRow(pq.Query, pq.Args...).Scan(&found)
+	if err != nil {
+		return err
+	}
+
+	if found == 0 {
+		pq = dbutl.PQuery(`
+			INSERT INTO rss_link (
+				rss_source_id,
+				link,
+				etag,
+				last_modified,
+				change_date
+			)
+			VALUES (?, ?, ?, ?, ?)
+		`, sourceID,
+			l.Link,
+			l.ETag,
+			l.LastModified,
+			time.Now().UTC())
+	} else {
+		pq = dbutl.PQuery(`
+			UPDATE rss_link
+			   SET etag = ?,
+			       last_modified = ?,
+			       change_date = ?
+			 WHERE rss_source_id = ?
+			   AND link = ?
+		`, l.ETag,
+			l.LastModified,
+			time.Now().UTC(),
+			sourceID,
+			l.Link)
+	}
+
+	_, err = dbutl.ExecTx(tx, pq)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/geo-stanciu/go-utils/utils"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// Full text is fetched for the items of the sources with FetchFullText set.
+// After the feed is saved, the link of every new item is downloaded by the
+// download pool, the main text of the page is found with a readability
+// style heuristic and saved in rss.article_content. The items left without
+// it (a full queue, a failed download) are queued again by the backfill.
+
+const (
+	defaultMaxArticleBytes = 2 << 20
+	// shorter texts are most likely not the article
+	minArticleLength = 250
+)
+
+var (
+	positiveClass = regexp.MustCompile(`(?i)article|body|content|entry|main|post|story|text`)
+	negativeClass = regexp.MustCompile(`(?i)ad-|ads|banner|comment|footer|menu|meta|nav|promo|related|share|sidebar|social|sponsor|widget`)
+)
+
+// elements never part of the article
+var skippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Aside:    true,
+	atom.Form:     true,
+	atom.Iframe:   true,
+	atom.Svg:      true,
+	atom.Button:   true,
+	atom.Select:   true,
+}
+
+// block elements, their text is put on separate lines
+var blockElements = map[atom.Atom]bool{
+	atom.P:          true,
+	atom.Div:        true,
+	atom.Section:    true,
+	atom.Article:    true,
+	atom.Blockquote: true,
+	atom.Pre:        true,
+	atom.Li:         true,
+	atom.Ul:         true,
+	atom.Ol:         true,
+	atom.H1:         true,
+	atom.H2:         true,
+	atom.H3:         true,
+	atom.H4:         true,
+	atom.H5:         true,
+	atom.H6:         true,
+	atom.Br:         true,
+	atom.Tr:         true,
+	atom.Table:      true,
+	atom.Figure:     true,
+}
+
+// queueFullText - fetch the full text of the inserted items
+func queueFullText(rss *rssSource, items []*RssItem) error {
+	client, err := rss.httpClient()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.RssID > 0 {
+			submitFullText(rss, client, item.RssID, item.Link)
+		}
+	}
+
+	return nil
+}
+
+type fullTextItem struct {
+	RssID int64  `sql:"rss_id"`
+	Link  string `sql:"link"`
+}
+
+// backfillFullText - fetch again the full text of the items of the source
+// added in the last downloadBackfillHours and still without it (dropped
+// on a full download queue or failed)
+func backfillFullText(rss *rssSource, sourceID int) error {
+	if sourceID <= 0 {
+		return nil
+	}
+
+	pq := dbutl.PQuery(`
+		SELECT rss_id,
+		       link
+		  FROM rss
+		 WHERE rss_source_id = ?
+		   AND article_content IS NULL
+		   AND link IS NOT NULL
+		   AND add_date >= ?
+	`, sourceID,
+		time.Now().UTC().Add(-downloadBackfillHours*time.Hour))
+
+	var items []fullTextItem
+
+	err := dbutl.ForEachRow(pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		item := fullTextItem{}
+		if err := sc.Scan(dbutl, row, &item); err != nil {
+			return err
+		}
+
+		items = append(items, item)
+
+		return nil
+	})
+
+	if err != nil || len(items) == 0 {
+		return err
+	}
+
+	client, err := rss.httpClient()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		submitFullText(rss, client, item.RssID, item.Link)
+	}
+
+	return nil
+}
+
+// submitFullText - queue the download of the article of the item
+// (once, see downloadPool.Submit)
+func submitFullText(rss *rssSource, client *fetchClient, rssID int64, link string) {
+	link = strings.TrimSpace(link)
+	if len(link) == 0 {
+		return
+	}
+
+	policy := rss.hostPolicy()
+	source := rss.SourceName
+
+	queued := downloads.Submit(fmt.Sprintf("article:%d", rssID), func() {
+		err := fetchFullText(rssID, link, client, policy)
+		if err != nil {
+			audit.Log(err,
+				"full text",
+				"fetch failed",
+				"source", source,
+				"rss_id", rssID,
+				"link", link)
+		}
+	})
+
+	if !queued {
+		audit.Log(nil,
+			"full text",
+			"download queue full, queued again by the backfill",
+			"source", source,
+			"rss_id", rssID,
+			"link", link)
+	}
+}
+
+// fetchFullText - download the article of the item and save its text
+func fetchFullText(rssID int64, link string, client *fetchClient, policy hostPolicy) error {
+	text, err := fetchArticle(link, client, policy)
+	if err != nil {
+		return err
+	} else if len(text) == 0 {
+		return nil
+	}
+
+	pq := dbutl.PQuery(`
+		UPDATE rss
+		   SET article_content = ?
+		 WHERE rss_id = ?
+	`, text,
+		rssID)
+
+	// writes are serialized with the feed saves
+	rssLock.Lock()
+	defer rssLock.Unlock()
+
+	_, err = dbutl.Exec(pq)
+
+	return err
+}
+
+// fetchArticle - main text of the page (empty if none was found)
+func fetchArticle(link string, client *fetchClient, policy hostPolicy) (string, error) {
+	req, err := client.newRequest(link)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	release, err := hostLimits.Acquire(link, policy)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	response, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if err = checkRetryAfter(link, response); err != nil {
+		return "", err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s answered %s", link, response.Status)
+	}
+
+	contentType := response.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil &&
+		mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+
+		return "", nil
+	}
+
+	maxBytes := config.MaxArticleBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxArticleBytes
+	}
+
+	body, err := charset.NewReader(io.LimitReader(response.Body, maxBytes), contentType)
+	if err != nil {
+		return "", err
+	}
+
+	doc, err := html.Parse(body)
+	if err != nil {
+		return "", err
+	}
+
+	return extractArticle(doc), nil
+}
+
+// extractArticle - readability style heuristic: the paragraphs score their
+// parent (and half as much their grandparent) by length and commas, the
+// class / id names and the share of link text adjust the score, and the
+// text of the best scored element is the article
+func extractArticle(doc *html.Node) string {
+	scores := make(map[*html.Node]float64)
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && skippedElements[n.DataAtom] {
+			return
+		}
+
+		if n.Type == html.ElementNode && (n.DataAtom == atom.P || n.DataAtom == atom.Pre) {
+			text := nodeText(n)
+			if len(text) >= 25 && n.Parent != nil {
+				score := 1 + float64(strings.Count(text, ",")) + float64(minInt(len(text)/100, 3))
+
+				scores[n.Parent] += score
+				if n.Parent.Parent != nil {
+					scores[n.Parent.Parent] += score / 2
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var best *html.Node
+	var bestScore float64
+
+	for n, score := range scores {
+		score += classWeight(n)
+		score *= 1 - linkDensity(n)
+
+		if best == nil || score > bestScore {
+			best = n
+			bestScore = score
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	writeText(&sb, best)
+
+	text := strings.TrimSpace(blankLines.ReplaceAllString(sb.String(), "\n\n"))
+	if len(text) < minArticleLength {
+		return ""
+	}
+
+	return text
+}
+
+var (
+	blankLines = regexp.MustCompile(`\s*\n\s*`)
+	spaces     = regexp.MustCompile(`\s+`)
+)
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+func classWeight(n *html.Node) float64 {
+	var weight float64
+
+	if n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		weight += 25
+	}
+
+	for _, name := range []string{attr(n, "class"), attr(n, "id")} {
+		if len(name) == 0 {
+			continue
+		}
+
+		if negativeClass.MatchString(name) {
+			weight -= 25
+		}
+
+		if positiveClass.MatchString(name) {
+			weight += 25
+		}
+	}
+
+	return weight
+}
+
+// nodeText - text of the node, with collapsed white space
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && skippedElements[n.DataAtom] {
+			return
+		}
+
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return strings.TrimSpace(spaces.ReplaceAllString(sb.String(), " "))
+}
+
+// linkDensity - share of the node text found in links
+func linkDensity(n *html.Node) float64 {
+	total := len(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+
+	linked := 0
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			linked += len(nodeText(n))
+			return
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return float64(linked) / float64(total)
+}
+
+// writeText - text of the node, the block elements on separate lines
+func writeText(sb *strings.Builder, n *html.Node) {
+	if n.Type == html.ElementNode && skippedElements[n.DataAtom] {
+		return
+	}
+
+	if n.Type == html.TextNode {
+		sb.WriteString(spaces.ReplaceAllString(n.Data, " "))
+		return
+	}
+
+	block := n.Type == html.ElementNode && blockElements[n.DataAtom]
+	if block {
+		sb.WriteByte('\n')
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(sb, c)
+	}
+
+	if block {
+		sb.WriteByte('\n')
+	}
+}
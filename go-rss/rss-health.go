@@ -0,0 +1,447 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geo-stanciu/go-utils/utils"
+)
+
+const (
+	defaultDisableAfterDays = 7
+	defaultStaleDays        = 14
+	defaultSlowMs           = 5000
+)
+
+// linkHealth - outcome of the fetches of a link, as kept in rss_health
+type linkHealth struct {
+	LoweredSourceName   string       `sql:"lowered_source_name"`
+	Link                string       `sql:"link"`
+	HTTPStatus          int          `sql:"http_status"`
+	LastError           string       `sql:"last_error"`
+	ItemCount           int          `sql:"item_count"`
+	NewItems            int          `sql:"new_items"`
+	LatencyMs           int64        `sql:"latency_ms"`
+	ConsecutiveFailures int          `sql:"consecutive_failures"`
+	FailingSince        sql.NullTime `sql:"failing_since"`
+	LastSuccess         sql.NullTime `sql:"last_success"`
+	LastNewItem         sql.NullTime `sql:"last_new_item"`
+	LastCheck           time.Time    `sql:"last_check"`
+	Disabled            int          `sql:"disabled"`
+}
+
+// disabledLinks - links not fetched until they are enabled again
+var disabledLinks = struct {
+	sync.RWMutex
+	links map[string]bool
+}{links: make(map[string]bool)}
+
+func healthKey(sourceName string, link string) string {
+	return strings.ToLower(sourceName) + "\x00" + link
+}
+
+// isDisabled - the link was disabled after failing for too long
+func (s *rssSource) isDisabled() bool {
+	disabledLinks.RLock()
+	defer disabledLinks.RUnlock()
+
+	return disabledLinks.links[healthKey(s.SourceName, s.Link)]
+}
+
+// skipDisabled - the link is disabled (logged, as someone has to enable it)
+func (s *rssSource) skipDisabled() bool {
+	if !s.isDisabled() {
+		return false
+	}
+
+	audit.Log(nil, "feed health", "link disabled, skipped", "source", s.SourceName, "link", s.Link)
+
+	return true
+}
+
+// loadDisabledLinks - the links disabled by previous runs
+func loadDisabledLinks() error {
+	pq := dbutl.PQuery(`
+		SELECT lowered_source_name,
+		       link
+		  FROM rss_health
+		 WHERE disabled = 1
+	`)
+
+	disabledLinks.Lock()
+	defer disabledLinks.Unlock()
+
+	return dbutl.ForEachRow(pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		var sourceName, link string
+		if err := row.Scan(&sourceName, &link); err != nil {
+			return err
+		}
+
+		disabledLinks.links[healthKey(sourceName, link)] = true
+
+		return nil
+	})
+}
+
+// reloadDisabled - read again if the link is disabled, the enable command
+// may have enabled it since it was loaded
+func (s *rssSource) reloadDisabled() error {
+	disabled := 0
+
+	pq := dbutl.PQuery(`
+		SELECT disabled
+		  FROM rss_health
+		 WHERE lowered_source_name = ?
+		   AND link = ?
+	`, strings.ToLower(s.SourceName),
+		s.Link)
+
+	err := db.QueryRow(pq.Query, pq.Args...).Scan(&disabled)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	disabledLinks.Lock()
+	defer disabledLinks.Unlock()
+
+	if disabled == 1 {
+		disabledLinks.links[healthKey(s.SourceName, s.Link)] = true
+	} else {
+		delete(disabledLinks.links, healthKey(s.SourceName, s.Link))
+	}
+
+	return nil
+}
+
+// disableAfter - how long a link may fail before it is disabled
+// (a negative DisableAfterDays never disables links)
+func disableAfter() time.Duration {
+	days := config.DisableAfterDays
+	if days == 0 {
+		days = defaultDisableAfterDays
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// recordHealth - save the outcome of the fetch of the link. A fetch not
+// made because the host is blocked by its Retry-After is not recorded:
+// the link did not fail, it was not asked.
+func (s *rssSource) recordHealth(fetchErr error) error {
+	var retry *retryAfterError
+	if errors.As(fetchErr, &retry) && retry.Blocked {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	// writes are serialized with the feed saves
+	rssLock.Lock()
+	defer rssLock.Unlock()
+
+	tx, err := dbutl.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer dbutl.Rollback(tx)
+
+	health := linkHealth{}
+
+	pq := dbutl.PQuery(`
+		SELECT lowered_source_name,
+		       link,
+		       consecutive_failures,
+		       failing_since,
+		       last_success,
+		       last_new_item,
+		       last_check,
+		       disabled
+		  FROM rss_health
+		 WHERE lowered_source_name = ?
+		   AND link = ?
+	`, strings.ToLower(s.SourceName),
+		s.Link)
+
+	err = dbutl.RunQueryTx(tx, pq, &health)
+	found := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	health.LoweredSourceName = strings.ToLower(s.SourceName)
+	health.Link = s.Link
+	health.HTTPStatus = s.httpStatus
+	health.ItemCount = s.itemCount
+	health.NewItems = s.newItems
+	health.LatencyMs = s.latency.Milliseconds()
+	health.LastCheck = now
+	health.LastError = ""
+
+	if fetchErr != nil {
+		health.LastError = fetchErr.Error()
+		health.ConsecutiveFailures++
+
+		if !health.FailingSince.Valid {
+			health.FailingSince = sql.NullTime{Time: now, Valid: true}
+		}
+
+		if config.DisableAfterDays >= 0 && now.Sub(health.FailingSince.Time) > disableAfter() {
+			health.Disabled = 1
+		}
+	} else {
+		health.ConsecutiveFailures = 0
+		health.FailingSince = sql.NullTime{}
+		health.LastSuccess = sql.NullTime{Time: now, Valid: true}
+	}
+
+	if health.NewItems > 0 {
+		health.LastNewItem = sql.NullTime{Time: now, Valid: true}
+	}
+
+	if found {
+		pq = dbutl.PQuery(`
+			UPDATE rss_health
+			   SET http_status = ?,
+			       last_error = ?,
+			       item_count = ?,
+			       new_items = ?,
+			       latency_ms = ?,
+			       consecutive_failures = ?,
+			       failing_since = ?,
+			       last_success = ?,
+			       last_new_item = ?,
+			       last_check = ?,
+			       disabled = ?
+			 WHERE lowered_source_name = ?
+			   AND link = ?
+		`, health.HTTPStatus,
+			health.LastError,
+			health.ItemCount,
+			health.NewItems,
+			health.LatencyMs,
+			health.ConsecutiveFailures,
+			health.FailingSince,
+			health.LastSuccess,
+			health.LastNewItem,
+			health.LastCheck,
+			health.Disabled,
+			health.LoweredSourceName,
+			health.Link)
+	} else {
+		pq = dbutl.PQuery(`
+			INSERT INTO rss_health (
+				lowered_source_name,
+				link,
+				http_status,
+				last_error,
+				item_count,
+				new_items,
+				latency_ms,
+				consecutive_failures,
+				failing_since,
+				last_success,
+				last_new_item,
+				last_check,
+				disabled
+			)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, health.LoweredSourceName,
+			health.Link,
+			health.HTTPStatus,
+			health.LastError,
+			health.ItemCount,
+			health.NewItems,
+			health.LatencyMs,
+			health.ConsecutiveFailures,
+			health.FailingSince,
+			health.LastSuccess,
+			health.LastNewItem,
+			health.LastCheck,
+			health.Disabled)
+	}
+
+	_, err = dbutl.ExecTx(tx, pq)
+	if err != nil {
+		return err
+	}
+
+	dbutl.Commit(tx)
+
+	if health.Disabled == 1 {
+		disabledLinks.Lock()
+		disabledLinks.links[healthKey(s.SourceName, s.Link)] = true
+		disabledLinks.Unlock()
+
+		audit.Log(fetchErr,
+			"feed health",
+			"link disabled",
+			"source", s.SourceName,
+			"link", s.Link,
+			"failing_since", health.FailingSince.Time)
+	}
+
+	return nil
+}
+
+func reportCommand(args []string) error {
+	staleDefault := config.StaleDays
+	if staleDefault <= 0 {
+		staleDefault = defaultStaleDays
+	}
+
+	slowDefault := config.SlowMs
+	if slowDefault <= 0 {
+		slowDefault = defaultSlowMs
+	}
+
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	staleDaysPtr := fs.Int("stale-days", staleDefault, "stale: no new items for this many days")
+	slowMsPtr := fs.Int("slow-ms", slowDefault, "slow: the last fetch took longer (ms)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	staleDate := time.Now().UTC().AddDate(0, 0, -*staleDaysPtr)
+
+	sections := []struct {
+		Title string
+		Where string
+		Args  []interface{}
+	}{
+		{"Disabled", "disabled = 1", nil},
+		{"Failing", "disabled = 0 AND consecutive_failures > 0", nil},
+		{
+			fmt.Sprintf("Stale (no new items in %d days)", *staleDaysPtr),
+			"disabled = 0 AND consecutive_failures = 0 AND coalesce(last_new_item, TIMESTAMP ?) < ?",
+			[]interface{}{"1970-01-01 00:00:00", staleDate},
+		},
+		{
+			fmt.Sprintf("Slow (over %d ms)", *slowMsPtr),
+			"disabled = 0 AND consecutive_failures = 0 AND latency_ms > ?",
+			[]interface{}{*slowMsPtr},
+		},
+	}
+
+	for _, section := range sections {
+		list, err := getHealth(section.Where, section.Args...)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s: %d\n", section.Title, len(list))
+
+		for _, h := range list {
+			fmt.Printf("  %-24s %s\n", h.LoweredSourceName, h.Link)
+			fmt.Printf("      status %d, %d items (%d new), %d ms, checked %s\n",
+				h.HTTPStatus,
+				h.ItemCount,
+				h.NewItems,
+				h.LatencyMs,
+				h.LastCheck.UTC().Format("2006-01-02 15:04"))
+
+			if h.ConsecutiveFailures > 0 {
+				fmt.Printf("      %d failures since %s: %s\n",
+					h.ConsecutiveFailures,
+					h.FailingSince.Time.UTC().Format("2006-01-02 15:04"),
+					h.LastError)
+			}
+
+			if h.LastNewItem.Valid {
+				fmt.Printf("      last new item %s\n", h.LastNewItem.Time.UTC().Format("2006-01-02 15:04"))
+			}
+		}
+
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// getHealth - health of the links matching the condition
+func getHealth(where string, args ...interface{}) ([]*linkHealth, error) {
+	pq := dbutl.PQuery(`
+		SELECT lowered_source_name,
+		       link,
+		       coalesce(http_status, 0) http_status,
+		       coalesce(last_error, '') last_error,
+		       coalesce(item_count, 0) item_count,
+		       coalesce(new_items, 0) new_items,
+		       coalesce(latency_ms, 0) latency_ms,
+		       consecutive_failures,
+		       failing_since,
+		       last_success,
+		       last_new_item,
+		       last_check,
+		       disabled
+		  FROM rss_health
+		 WHERE `+where+`
+		 ORDER BY lowered_source_name, link
+	`, args...)
+
+	var list []*linkHealth
+
+	err := dbutl.ForEachRow(pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		h := linkHealth{}
+		if err := sc.Scan(dbutl, row, &h); err != nil {
+			return err
+		}
+
+		list = append(list, &h)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func enableCommand(args []string) error {
+	fs := flag.NewFlagSet("enable", flag.ContinueOnError)
+	sourcePtr := fs.String("source", "", "source to enable")
+	linkPtr := fs.String("link", "", "only enable this link of the source")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*sourcePtr) == 0 {
+		return fmt.Errorf("usage: enable -source <name> [-link <url>]")
+	}
+
+	query := `
+		UPDATE rss_health
+		   SET disabled = 0,
+		       consecutive_failures = 0,
+		       failing_since = NULL
+		 WHERE lowered_source_name = ?
+	`
+	queryArgs := []interface{}{strings.ToLower(*sourcePtr)}
+
+	if len(*linkPtr) > 0 {
+		query += " AND link = ?"
+		queryArgs = append(queryArgs, *linkPtr)
+	}
+
+	res, err := dbutl.Exec(dbutl.PQuery(query, queryArgs...))
+	if err != nil {
+		return err
+	}
+
+	enabled, _ := res.RowsAffected()
+
+	audit.Log(nil,
+		"feed health",
+		"links enabled",
+		"source", *sourcePtr,
+		"link", *linkPtr,
+		"links", enabled)
+
+	return nil
+}
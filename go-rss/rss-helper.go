@@ -51,6 +51,10 @@ type RssItem struct {
 	MediaContent RssMediaContent
 	Enclosure    RssEnclosure
 	RssDate      time.Time `sql:"rss_date"`
+	ItemKey      string    `xml:"-" sql:"item_key"`
+	ContentHash  string    `xml:"-" sql:"content_hash"`
+	// detected from the title and description, empty if unknown
+	DetectedLanguage string `xml:"-" sql:"detected_language"`
 }
 
 // RssImage - RssImage Item struct
@@ -81,6 +85,12 @@ type RssFeed struct {
 	Feed        *RSSFeed
 	FeedLink    *RssLink
 	Rss         []*RssItem
+	// refresh the stored items whose content changed
+	UpdateInPlace bool `xml:"-"`
+	// items inserted by Save
+	Inserted []*RssItem `xml:"-"`
+	// alerts raised by the inserted items
+	Alerts []*rssAlert `xml:"-"`
 }
 
 type rssLastDate struct {
@@ -309,6 +319,9 @@ func (r *RssFeed) Save(tx *sql.Tx) error {
 
 	lastUpdate := epochStart
 
+	// without the items in the database, an item is new by its date only
+	stored := storeInDatabase()
+
 	for _, rss := range r.Rss {
 		if len(rss.Date) == 0 {
 			rss.RssDate = time.Now().UTC()
@@ -320,77 +333,64 @@ func (r *RssFeed) Save(tx *sql.Tx) error {
 		}
 
 		r.Feed.Lock()
-		if !rss.RssDate.After(r.Feed.LastUpdate) {
-			r.Feed.Unlock()
+		isNew := rss.RssDate.After(r.Feed.LastUpdate)
+		r.Feed.Unlock()
+
+		// older items are only looked at to refresh them in place
+		if !isNew && !r.UpdateInPlace {
 			continue
 		}
-		r.Feed.Unlock()
 
 		if len(rss.Link) == 0 {
 			continue
 		}
 
-		found, err := r.rssExists(tx, rss.Title, rss.Link)
-		if err != nil {
-			return err
+		rss.ItemKey = rss.dedupeKey()
+		rss.ContentHash = rss.contentHash()
+		rss.DetectedLanguage = rss.detectLanguage()
+
+		rssID, storedHash := int64(0), ""
+
+		if stored {
+			rssID, storedHash, err = r.findRss(tx, rss)
+			if err != nil {
+				return err
+			}
 		}
 
-		if found {
+		if rssID > 0 {
+			if r.UpdateInPlace && storedHash != rss.ContentHash {
+				if err = r.updateRss(tx, rssID, rss); err != nil {
+					return err
+				}
+			}
+
 			continue
 		}
 
-		pq = dbutl.PQuery(`
-			INSERT INTO rss (
-				rss_source_id,
-				title,
-				link,
-				description,
-				item_guid,
-				orig_link,
-				category,
-				subcategory,
-				content,
-				keywords,
-				tags,
-				creator,
-				enclosure_link,
-				enclosure_length,
-				enclosure_filetype,
-				media_link,
-				media_filetype,
-				media_thumbnail,
-				rss_date,
-				add_date
-			)
-			VALUES (
-				?, ?, ?, ?, ?,
-				?, ?, ?, ?, ?,
-				?, ?, ?, ?, ?,
-				?, ?, ?, ?, ?
-			)
-		`, r.SourceID,
-			strings.TrimSpace(rss.Title),
-			strings.TrimSpace(rss.Link),
-			strings.TrimSpace(rss.Description),
-			strings.TrimSpace(rss.ItemGUID),
-			strings.TrimSpace(rss.OrigLink),
-			strings.TrimSpace(rss.Category),
-			strings.TrimSpace(rss.SubCategory),
-			strings.TrimSpace(rss.Content),
-			strings.TrimSpace(rss.Keywords),
-			strings.TrimSpace(rss.Tags),
-			strings.TrimSpace(rss.Creator),
-			strings.TrimSpace(rss.Enclosure.URL),
-			rss.Enclosure.Length,
-			rss.Enclosure.Type,
-			strings.TrimSpace(rss.MediaContent.URL),
-			rss.MediaContent.Type,
-			strings.TrimSpace(rss.Thumbnail.URL),
-			rss.RssDate.UTC(),
-			dt)
+		if !isNew {
+			continue
+		}
 
-		_, err = dbutl.ExecTx(tx, pq)
-		if err != nil {
+		if stored {
+			if err = r.insertRss(tx, rss, dt); err != nil {
+				return err
+			}
+		} else {
+			// undated items are new on every fetch, their key tells
+			published, err := r.markPublished(tx, rss, dt)
+			if err != nil {
+				return err
+			}
+
+			if published {
+				continue
+			}
+		}
+
+		r.Inserted = append(r.Inserted, rss)
+
+		if err = r.checkAlerts(tx, rss); err != nil {
 			return err
 		}
 
@@ -404,11 +404,19 @@ func (r *RssFeed) Save(tx *sql.Tx) error {
 			r.Feed.Unlock()
 		}
 
-		if lastUpdate.Before(rss.RssDate) {
+		// the fetch time of the undated items would hide the items
+		// published before it and fetched later
+		if len(rss.Date) > 0 && lastUpdate.Before(rss.RssDate) {
 			lastUpdate = rss.RssDate
 		}
 	}
 
+	if !stored {
+		if err = r.prunePublished(tx, dt); err != nil {
+			return err
+		}
+	}
+
 	r.Feed.Lock()
 	if r.FeedLink.RssDate.IsZero() || r.FeedLink.RssDate.Before(lastUpdate) {
 		r.FeedLink.RssDate = lastUpdate
@@ -418,32 +426,96 @@ func (r *RssFeed) Save(tx *sql.Tx) error {
 	return err
 }
 
-func (r *RssFeed) rssExists(tx *sql.Tx, title string, link string) (bool, error) {
-	found := 0
-
+// insertRss - insert the new item and read back its id
+func (r *RssFeed) insertRss(tx *sql.Tx, rss *RssItem, dt time.Time) error {
 	pq := dbutl.PQuery(`
-		SELECT CASE WHEN EXISTS (
-			SELECT 1
-			  FROM rss
-			 WHERE rss_source_id = ?
-			   AND title = ?
-			   AND link = ?
-		) THEN 1 ELSE 0 END
-		FROM dual
+		INSERT INTO rss (
+			rss_source_id,
+			title,
+			link,
+			description,
+			item_guid,
+			orig_link,
+			category,
+			subcategory,
+			content,
+			keywords,
+			tags,
+			creator,
+			enclosure_link,
+			enclosure_length,
+			enclosure_filetype,
+			media_link,
+			media_filetype,
+			media_thumbnail,
+			rss_date,
+			add_date,
+			item_key,
+			content_hash,
+			detected_language
+		)
+		VALUES (
+			?, ?, ?, ?, ?,
+			?, ?, ?, ?, ?,
+			?, ?, ?, ?, ?,
+			?, ?, ?, ?, ?,
+			?, ?, ?
+		)
 	`, r.SourceID,
-		strings.TrimSpace(title),
-		strings.TrimSpace(link))
+		strings.TrimSpace(rss.Title),
+		strings.TrimSpace(rss.Link),
+		strings.TrimSpace(rss.Description),
+		strings.TrimSpace(rss.ItemGUID),
+		strings.TrimSpace(rss.OrigLink),
+		strings.TrimSpace(rss.Category),
+		strings.TrimSpace(rss.SubCategory),
+		strings.TrimSpace(rss.Content),
+		strings.TrimSpace(rss.Keywords),
+		strings.TrimSpace(rss.Tags),
+		strings.TrimSpace(rss.Creator),
+		strings.TrimSpace(rss.Enclosure.URL),
+		rss.Enclosure.Length,
+		rss.Enclosure.Type,
+		strings.TrimSpace(rss.MediaContent.URL),
+		rss.MediaContent.Type,
+		strings.TrimSpace(rss.Thumbnail.URL),
+		rss.RssDate.UTC(),
+		dt,
+		rss.ItemKey,
+		rss.ContentHash,
+		nullString(rss.DetectedLanguage))
+
+	_, err := dbutl.ExecTx(tx, pq)
+	if err != nil {
+		return err
+	}
 
-	err := tx.QueryRow(pq.Query, pq.Args...).Scan(&found)
+	rss.RssID, err = r.getRssID(tx, rss.ItemKey)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	if found == 0 {
-		return false, nil
+	return nil
+}
+
+// getRssID - id of the item with the given key
+func (r *RssFeed) getRssID(tx *sql.Tx, itemKey string) (int64, error) {
+	var rssID int64
+
+	pq := dbutl.PQuery(`
+		SELECT rss_id
+		  FROM rss
+		 WHERE rss_source_id = ?
+		   AND item_key = ?
+	`, r.SourceID,
+		itemKey)
+
+	err := tx.QueryRow(pq.Query, pq.Args...).Scan(&rssID)
+	if err != nil {
+		return 0, err
 	}
 
-	return true, nil
+	return rssID, nil
 }
 
 func getLastRSS(source string) (time.Time, error) {
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+// The language of each item is detected from its title and description by
+// counting the stop words of each language. Texts too short or too mixed
+// to tell keep detected_language NULL, and the queries fall back on the
+// language of the source: coalesce(r.detected_language, lower(s.language)).
+
+// minimum stop words found, and by how much the best language must lead
+const (
+	minLanguageHits   = 2
+	minLanguageMargin = 1.5
+)
+
+var stopWords = map[string][]string{
+	"ro": {
+		"și", "şi", "în", "din", "la", "cu", "pe", "de", "care", "este", "sunt", "fost",
+		"pentru", "mai", "ca", "că", "nu", "se", "un", "o", "al", "ale", "lui", "după",
+		"prin", "despre", "sau", "dar", "acest", "această", "au", "va", "vor", "către",
+	},
+	"en": {
+		"the", "and", "of", "to", "in", "is", "are", "was", "were", "for", "on", "with",
+		"that", "this", "by", "from", "at", "as", "it", "its", "be", "has", "have", "will",
+		"after", "over", "new", "says", "an", "or", "but", "not", "who", "into",
+	},
+	"fr": {
+		"le", "la", "les", "des", "et", "du", "une", "est", "pour", "dans", "qui", "sur",
+		"au", "aux", "avec", "pas", "plus", "par", "ce", "cette", "sont", "été", "après",
+	},
+	"de": {
+		"der", "die", "das", "und", "ist", "nicht", "mit", "von", "den", "dem", "ein",
+		"eine", "für", "auf", "auch", "sich", "zu", "im", "nach", "wird", "werden", "bei",
+	},
+	"it": {
+		"il", "lo", "gli", "della", "delle", "del", "che", "è", "per", "con", "sono",
+		"una", "nel", "alla", "dei", "non", "più", "come", "dopo", "anche", "questo",
+	},
+	"es": {
+		"el", "los", "las", "del", "que", "y", "es", "por", "con", "para", "una", "su",
+		"al", "como", "más", "pero", "sus", "fue", "este", "esta", "tras", "sobre",
+	},
+	"hu": {
+		"a", "az", "és", "hogy", "nem", "egy", "is", "van", "meg", "már", "csak", "mint",
+		"után", "volt", "lesz", "ezt", "azt", "kell", "még", "szerint",
+	},
+}
+
+var stopWordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool)
+
+	for lang, words := range stopWords {
+		sets[lang] = make(map[string]bool)
+
+		for _, w := range words {
+			sets[lang][w] = true
+		}
+	}
+
+	return sets
+}()
+
+// letters only found in some languages
+var languageLetters = map[string]string{
+	"ro": "ăâîșşțţ",
+	"hu": "őű",
+	"de": "ß",
+}
+
+// detectLanguage - language of the text as an ISO 639-1 code
+// (empty if it can not be told)
+func detectLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	scores := make(map[string]float64)
+
+	for _, w := range words {
+		for lang, set := range stopWordSets {
+			if set[w] {
+				scores[lang]++
+			}
+		}
+	}
+
+	for lang, letters := range languageLetters {
+		if strings.ContainsAny(strings.ToLower(text), letters) {
+			scores[lang] += 2
+		}
+	}
+
+	best, second := "", ""
+
+	for lang := range stopWordSets {
+		if best == "" || scores[lang] > scores[best] {
+			best, second = lang, best
+		} else if second == "" || scores[lang] > scores[second] {
+			second = lang
+		}
+	}
+
+	if scores[best] < minLanguageHits {
+		return ""
+	}
+
+	if scores[second] > 0 && scores[best] < scores[second]*minLanguageMargin {
+		return ""
+	}
+
+	return best
+}
+
+// detectLanguage - language of the item, from its title and description
+func (rss *RssItem) detectLanguage() string {
+	return detectLanguage(strings.Join([]string{
+		rss.Title,
+		stripTags(rss.Description),
+	}, "\n"))
+}
+
+// stripTags - the text of an HTML fragment, good enough for counting words
+func stripTags(s string) string {
+	var sb strings.Builder
+
+	inTag := false
+
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+			sb.WriteRune(' ')
+		case r == '>':
+			inTag = false
+		case !inTag:
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
+// nullString - NULL for an empty string
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: len(s) > 0}
+}
+
+// itemLanguage - detected language of the item, else the one of the source
+func itemLanguage(detected string, sourceLang string) string {
+	if len(detected) > 0 {
+		return detected
+	}
+
+	return strings.ToLower(sourceLang)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"Breaking: 42", ""},
+		{"Hello World", ""},
+		{"Guvernul a aprobat în ședința de azi un proiect care este important pentru economie", "ro"},
+		{"Guvernul a aprobat in sedinta de azi un proiect care este important pentru economie", "ro"},
+		{"The government has approved the new plan for the economy after the vote", "en"},
+		{"Le gouvernement a présenté les mesures pour la relance dans les régions", "fr"},
+		{"Die Regierung hat nicht mit der Opposition über den Plan für das Jahr gesprochen", "de"},
+		{"Il governo ha approvato il piano per la crescita che è stato presentato dopo il voto", "it"},
+		{"El gobierno aprobó el plan para la economía que fue presentado tras las elecciones", "es"},
+		{"A kormány szerint az új törvény még nem lesz hatályban, és csak jövőre", "hu"},
+		// as many stop words of each language
+		{"the and le et", ""},
+	}
+
+	for _, tt := range tests {
+		if got := detectLanguage(tt.text); got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestItemLanguage(t *testing.T) {
+	tests := []struct {
+		detected string
+		source   string
+		want     string
+	}{
+		{"ro", "EN", "ro"},
+		{"", "EN", "en"},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		if got := itemLanguage(tt.detected, tt.source); got != tt.want {
+			t.Errorf("itemLanguage(%q, %q) = %q, want %q", tt.detected, tt.source, got, tt.want)
+		}
+	}
+}
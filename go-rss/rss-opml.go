@@ -0,0 +1,315 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/geo-stanciu/go-utils/utils"
+	"golang.org/x/net/html/charset"
+)
+
+// Opml - OPML document
+type Opml struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    OpmlHead `xml:"head"`
+	Body    OpmlBody `xml:"body"`
+}
+
+// OpmlHead - OPML head
+type OpmlHead struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+// OpmlBody - OPML body
+type OpmlBody struct {
+	Outlines []*OpmlOutline `xml:"outline"`
+}
+
+// OpmlOutline - feed, or folder of outlines
+type OpmlOutline struct {
+	Text     string         `xml:"text,attr"`
+	Title    string         `xml:"title,attr,omitempty"`
+	Type     string         `xml:"type,attr,omitempty"`
+	XMLURL   string         `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string         `xml:"htmlUrl,attr,omitempty"`
+	Language string         `xml:"language,attr,omitempty"`
+	Outlines []*OpmlOutline `xml:"outline"`
+}
+
+// feeds - the feed outlines, including the ones in folders
+func (o *OpmlOutline) feeds() []*OpmlOutline {
+	var list []*OpmlOutline
+
+	if len(strings.TrimSpace(o.XMLURL)) > 0 {
+		list = append(list, o)
+	}
+
+	for _, child := range o.Outlines {
+		list = append(list, child.feeds()...)
+	}
+
+	return list
+}
+
+// sourceName - the name of the source the feed belongs to
+func (o *OpmlOutline) sourceName() string {
+	for _, name := range []string{o.Title, o.Text, o.XMLURL} {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			return name
+		}
+	}
+
+	return ""
+}
+
+func opmlImportCommand(args []string) error {
+	fs := flag.NewFlagSet("opml-import", flag.ContinueOnError)
+	langPtr := fs.String("lang", "EN", "language of the feeds without a language attribute")
+	dryRunPtr := fs.Bool("dry-run", false, "only show what would be added")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: opml-import [flags] <file.opml>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var opml Opml
+
+	dec := xml.NewDecoder(f)
+	dec.CharsetReader = charset.NewReaderLabel
+	if err = dec.Decode(&opml); err != nil {
+		return err
+	}
+
+	added := config.mergeOpml(&opml, *langPtr)
+
+	for _, link := range added {
+		fmt.Println(link)
+	}
+
+	if !*dryRunPtr && len(added) > 0 {
+		if err = config.rssSources.SaveToFile(rssSourcesFile()); err != nil {
+			return err
+		}
+	}
+
+	audit.Log(nil,
+		"opml import",
+		"Import done.",
+		"file", fs.Arg(0),
+		"new_links", len(added),
+		"dry_run", *dryRunPtr)
+
+	return nil
+}
+
+// mergeOpml - add the feeds not yet configured, the feeds with the same
+// name are grouped under one source
+func (c *configuration) mergeOpml(opml *Opml, defaultLang string) []string {
+	var added []string
+
+	for _, outline := range opml.Body.Outlines {
+		for _, feed := range outline.feeds() {
+			name := feed.sourceName()
+			link := strings.TrimSpace(feed.XMLURL)
+
+			lang := strings.ToUpper(strings.TrimSpace(feed.Language))
+			if len(lang) == 0 {
+				lang = defaultLang
+			}
+
+			if c.addSourceLink(name, lang, link) {
+				added = append(added, link)
+			}
+		}
+	}
+
+	return added
+}
+
+// getSource - the configured source with the name (nil if none)
+func (c *configuration) getSource(sourceName string) *rssSource {
+	for i := range c.Rss {
+		if strings.EqualFold(c.Rss[i].SourceName, sourceName) {
+			return &c.Rss[i]
+		}
+	}
+
+	return nil
+}
+
+// findLink - the configured source with the link (nil if none)
+func (c *configuration) findLink(link string) *rssSource {
+	for i := range c.Rss {
+		if c.Rss[i].hasLink(link) {
+			return &c.Rss[i]
+		}
+	}
+
+	return nil
+}
+
+func (s *rssSource) hasLink(link string) bool {
+	link = normalizeLink(link)
+
+	if normalizeLink(s.Link) == link {
+		return true
+	}
+
+	for _, lnk := range s.Links {
+		if normalizeLink(lnk) == link {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dbSource - source gathered before, as saved in the database
+type dbSource struct {
+	SourceName string `sql:"source_name"`
+	Lang       string `sql:"language"`
+	SourceLink string `sql:"source_link"`
+	Link       string `sql:"link"`
+}
+
+func opmlExportCommand(args []string) error {
+	fs := flag.NewFlagSet("opml-export", flag.ContinueOnError)
+	outPtr := fs.String("o", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opml, err := exportOpml()
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+
+	if len(*outPtr) > 0 {
+		f, err := os.Create(*outPtr)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		out = f
+	}
+
+	io.WriteString(out, xml.Header)
+
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err = enc.Encode(opml); err != nil {
+		return err
+	}
+	io.WriteString(out, "\n")
+
+	if len(*outPtr) > 0 {
+		audit.Log(nil, "opml export", "Export done.", "file", *outPtr, "feeds", len(opml.Body.Outlines))
+	}
+
+	return nil
+}
+
+// exportOpml - configured sources, followed by the ones only found in the database
+func exportOpml() (*Opml, error) {
+	opml := Opml{
+		Version: "2.0",
+		Head: OpmlHead{
+			Title:       appName,
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	sources := make(map[string]*OpmlOutline)
+	var names []string
+
+	addFeed := func(name string, lang string, htmlURL string, link string) {
+		link = strings.TrimSpace(link)
+		if len(link) == 0 {
+			return
+		}
+
+		lowered := strings.ToLower(name)
+
+		source, ok := sources[lowered]
+		if !ok {
+			source = &OpmlOutline{Text: name, Title: name}
+			sources[lowered] = source
+			names = append(names, lowered)
+		}
+
+		for _, feed := range source.Outlines {
+			if normalizeLink(feed.XMLURL) == normalizeLink(link) {
+				return
+			}
+		}
+
+		source.Outlines = append(source.Outlines, &OpmlOutline{
+			Text:     name,
+			Title:    name,
+			Type:     "rss",
+			XMLURL:   link,
+			HTMLURL:  strings.TrimSpace(htmlURL),
+			Language: strings.ToLower(lang),
+		})
+	}
+
+	for _, rss := range config.Rss {
+		addFeed(rss.SourceName, rss.Lang, "", rss.Link)
+
+		for _, lnk := range rss.Links {
+			addFeed(rss.SourceName, rss.Lang, "", lnk)
+		}
+	}
+
+	// rss_link holds every link gathered since it was added
+	pq := dbutl.PQuery(`
+		SELECT s.source_name,
+		       s.language,
+		       coalesce(s.source_link, '') source_link,
+		       l.link
+		  FROM rss_source s
+		  JOIN rss_link l ON (l.rss_source_id = s.rss_source_id)
+		 ORDER BY s.source_name, l.link
+	`)
+
+	err := dbutl.ForEachRow(pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		src := dbSource{}
+		if err := sc.Scan(dbutl, row, &src); err != nil {
+			return err
+		}
+
+		addFeed(src.SourceName, src.Lang, src.SourceLink, src.Link)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// one outline per feed, the feeds of a source share its name
+	for _, name := range names {
+		opml.Body.Outlines = append(opml.Body.Outlines, sources[name].Outlines...)
+	}
+
+	return &opml, nil
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/geo-stanciu/go-utils/utils"
+)
+
+// Expired items are moved to rss_archive (ArchiveMode "table") or written
+// to ArchiveDir as gzipped JSON lines (ArchiveMode "file") before they are
+// deleted, with their alerts (rss_alert_archive, or an "alerts" list in each
+// JSON line). rss_source.last_rss_date is moved past the removed items, so
+// they are not imported again. The enclosure files of the removed items
+// are deleted from EnclosureDir once no other item links them.
+
+// columns copied to rss_archive
+const rssArchiveColumns = `
+	rss_id,
+	rss_source_id,
+	title,
+	link,
+	description,
+	item_guid,
+	orig_link,
+	rss_date,
+	add_date,
+	keywords,
+	category,
+	subcategory,
+	content,
+	tags,
+	creator,
+	enclosure_link,
+	enclosure_length,
+	enclosure_filetype,
+	media_link,
+	media_filetype,
+	media_thumbnail,
+	item_key,
+	content_hash,
+	update_date,
+	article_content,
+	detected_language,
+	cluster_id,
+	seen
+`
+
+// archivedRss - expired item as exported to the JSON lines archive
+type archivedRss struct {
+	RssID             int64     `sql:"rss_id" json:"rss_id"`
+	SourceID          int       `sql:"rss_source_id" json:"rss_source_id"`
+	Title             string    `sql:"title" json:"title"`
+	Link              string    `sql:"link" json:"link"`
+	Description       string    `sql:"description" json:"description,omitempty"`
+	ItemGUID          string    `sql:"item_guid" json:"item_guid,omitempty"`
+	OrigLink          string    `sql:"orig_link" json:"orig_link,omitempty"`
+	RssDate           time.Time `sql:"rss_date" json:"rss_date"`
+	AddDate           time.Time `sql:"add_date" json:"add_date"`
+	Keywords          string    `sql:"keywords" json:"keywords,omitempty"`
+	Category          string    `sql:"category" json:"category,omitempty"`
+	SubCategory       string    `sql:"subcategory" json:"subcategory,omitempty"`
+	Content           string    `sql:"content" json:"content,omitempty"`
+	Tags              string    `sql:"tags" json:"tags,omitempty"`
+	Creator           string    `sql:"creator" json:"creator,omitempty"`
+	EnclosureLink     string    `sql:"enclosure_link" json:"enclosure_link,omitempty"`
+	EnclosureLength   int64     `sql:"enclosure_length" json:"enclosure_length,omitempty"`
+	EnclosureFiletype string    `sql:"enclosure_filetype" json:"enclosure_filetype,omitempty"`
+	MediaLink         string    `sql:"media_link" json:"media_link,omitempty"`
+	MediaFiletype     string    `sql:"media_filetype" json:"media_filetype,omitempty"`
+	MediaThumbnail    string    `sql:"media_thumbnail" json:"media_thumbnail,omitempty"`
+	ItemKey           string    `sql:"item_key" json:"item_key,omitempty"`
+	ContentHash       string    `sql:"content_hash" json:"content_hash,omitempty"`
+	ArticleContent    string    `sql:"article_content" json:"article_content,omitempty"`
+	DetectedLanguage  string    `sql:"detected_language" json:"detected_language,omitempty"`
+	ClusterID         int64     `sql:"cluster_id" json:"cluster_id,omitempty"`
+}
+
+// archivedAlert - alert of an expired item, as exported with it
+type archivedAlert struct {
+	RssAlertID int64     `sql:"rss_alert_id" json:"rss_alert_id"`
+	RssID      int64     `sql:"rss_id" json:"-"`
+	RuleName   string    `sql:"rule_name" json:"rule_name"`
+	Matched    string    `sql:"matched" json:"matched,omitempty"`
+	Notified   int       `sql:"notified" json:"notified"`
+	AddDate    time.Time `sql:"add_date" json:"add_date"`
+}
+
+// archivedItem - line of the JSON lines archive
+type archivedItem struct {
+	*archivedRss
+	Alerts []*archivedAlert `json:"alerts,omitempty"`
+}
+
+// retentionPolicy - how long the items of a source are kept
+type retentionPolicy struct {
+	SourceName string
+	KeepDays   int
+	KeepItems  int
+}
+
+// expiredItems - items of the source past the policy
+type expiredItems struct {
+	SourceID int
+	Where    string
+	Args     []interface{}
+}
+
+func retentionCommand(args []string) error {
+	fs := flag.NewFlagSet("retention", flag.ContinueOnError)
+	sourcePtr := fs.String("source", "", "only apply the policy of this source")
+	dryRunPtr := fs.Bool("dry-run", false, "only count the expired items")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	archive := strings.ToLower(config.ArchiveMode)
+	if len(archive) == 0 {
+		archive = "table"
+	}
+
+	if archive != "table" && archive != "file" {
+		return fmt.Errorf("unknown ArchiveMode: %s", config.ArchiveMode)
+	}
+
+	for _, policy := range getRetentionPolicies() {
+		if len(*sourcePtr) > 0 && !strings.EqualFold(*sourcePtr, policy.SourceName) {
+			continue
+		}
+
+		if err := policy.apply(archive, *dryRunPtr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getRetentionPolicies - policy of every configured source
+// (sources without own settings use the global ones)
+func getRetentionPolicies() []retentionPolicy {
+	var policies []retentionPolicy
+
+	for _, rss := range config.Rss {
+		policy := retentionPolicy{
+			SourceName: rss.SourceName,
+			KeepDays:   rss.KeepDays,
+			KeepItems:  rss.KeepItems,
+		}
+
+		if policy.KeepDays == 0 && policy.KeepItems == 0 {
+			policy.KeepDays = config.KeepDays
+			policy.KeepItems = config.KeepItems
+		}
+
+		if policy.KeepDays <= 0 && policy.KeepItems <= 0 {
+			continue
+		}
+
+		policies = append(policies, policy)
+	}
+
+	return policies
+}
+
+func (p *retentionPolicy) apply(archive string, dryRun bool) error {
+	tx, err := dbutl.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer dbutl.Rollback(tx)
+
+	expired, err := p.getExpired(tx)
+	if err != nil {
+		return err
+	} else if expired == nil {
+		return nil
+	}
+
+	var count int64
+	var maxDate sql.NullTime
+
+	pq := dbutl.PQuery(`
+		SELECT count(*),
+		       max(rss_date)
+		  FROM rss
+	`+expired.Where, expired.Args...)
+
+	err = tx.QueryRow(pq.Query, pq.Args...).Scan(&count, &maxDate)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 || dryRun {
+		audit.Log(nil,
+			"rss retention",
+			"expired items",
+			"source", p.SourceName,
+			"expired", count,
+			"dry_run", dryRun)
+
+		return nil
+	}
+
+	switch archive {
+	case "table":
+		pq = dbutl.PQuery(`
+			INSERT INTO rss_archive (`+rssArchiveColumns+`, archive_date)
+			SELECT `+rssArchiveColumns+`, ?
+			  FROM rss
+		`+expired.Where, append([]interface{}{time.Now().UTC()}, expired.Args...)...)
+
+		if _, err = dbutl.ExecTx(tx, pq); err != nil {
+			return err
+		}
+
+		pq = dbutl.PQuery(`
+			INSERT INTO rss_alert_archive (
+				rss_alert_id,
+				rss_id,
+				rule_name,
+				matched,
+				notified,
+				add_date,
+				archive_date
+			)
+			SELECT rss_alert_id,
+			       rss_id,
+			       rule_name,
+			       matched,
+			       notified,
+			       add_date,
+			       ?
+			  FROM rss_alert
+			 WHERE rss_id IN (
+				SELECT rss_id
+				  FROM rss
+				`+expired.Where+`
+			 )
+		`, append([]interface{}{time.Now().UTC()}, expired.Args...)...)
+
+		if _, err = dbutl.ExecTx(tx, pq); err != nil {
+			return err
+		}
+	case "file":
+		if err = p.exportExpired(tx, expired); err != nil {
+			return err
+		}
+	}
+
+	files, err := expiredEnclosureFiles(tx, expired)
+	if err != nil {
+		return err
+	}
+
+	// dependent rows first
+	for _, table := range []string{"rss_alert", "rss_enclosure"} {
+		pq = dbutl.PQuery(`
+			DELETE FROM `+table+`
+			 WHERE rss_id IN (
+				SELECT rss_id
+				  FROM rss
+				`+expired.Where+`
+			 )
+		`, expired.Args...)
+
+		if _, err = dbutl.ExecTx(tx, pq); err != nil {
+			return err
+		}
+	}
+
+	pq = dbutl.PQuery(`
+		DELETE FROM rss
+	`+expired.Where, expired.Args...)
+
+	if _, err = dbutl.ExecTx(tx, pq); err != nil {
+		return err
+	}
+
+	// the gatherer skips items not newer than last_rss_date,
+	// so the deleted items are not imported again
+	if maxDate.Valid {
+		pq = dbutl.PQuery(`
+			UPDATE rss_source
+			   SET last_rss_date = ?
+			 WHERE rss_source_id = ?
+			   AND last_rss_date < ?
+		`, maxDate.Time.UTC(),
+			expired.SourceID,
+			maxDate.Time.UTC())
+
+		if _, err = dbutl.ExecTx(tx, pq); err != nil {
+			return err
+		}
+	}
+
+	dbutl.Commit(tx)
+
+	removed := removeEnclosureFiles(files)
+
+	audit.Log(nil,
+		"rss retention",
+		"expired items removed",
+		"source", p.SourceName,
+		"archive", archive,
+		"removed", count,
+		"removed_files", removed)
+
+	return nil
+}
+
+// expiredEnclosureFiles - the stored files of the expired items
+func expiredEnclosureFiles(tx *sql.Tx, expired *expiredItems) ([]string, error) {
+	var files []string
+
+	pq := dbutl.PQuery(`
+		SELECT DISTINCT file_path
+		  FROM rss_enclosure
+		 WHERE rss_id IN (
+			SELECT rss_id
+			  FROM rss
+			`+expired.Where+`
+		 )
+	`, expired.Args...)
+
+	err := dbutl.ForEachRowTx(tx, pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		var file string
+		if err := row.Scan(&file); err != nil {
+			return err
+		}
+
+		files = append(files, file)
+
+		return nil
+	})
+
+	return files, err
+}
+
+// removeEnclosureFiles - delete the files no rss_enclosure row links anymore
+// (the store is content-addressed, so other items may share a file)
+func removeEnclosureFiles(files []string) int {
+	removed := 0
+
+	for _, file := range files {
+		var links int
+
+		pq := dbutl.PQuery(`
+			SELECT count(*)
+			  FROM rss_enclosure
+			 WHERE file_path = ?
+		`, file)
+
+		err := db.QueryRow(pq.Query, pq.Args...).Scan(&links)
+		if err != nil {
+			audit.Log(err, "rss retention", "enclosure check failed", "file", file)
+			continue
+		} else if links > 0 {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(enclosureDir(), filepath.FromSlash(file)))
+		if err != nil && !os.IsNotExist(err) {
+			audit.Log(err, "rss retention", "enclosure delete failed", "file", file)
+			continue
+		}
+
+		removed++
+	}
+
+	return removed
+}
+
+// getExpired - condition selecting the expired items of the source
+// (nil if the source was never gathered)
+func (p *retentionPolicy) getExpired(tx *sql.Tx) (*expiredItems, error) {
+	var sourceID int
+
+	pq := dbutl.PQuery(`
+		SELECT rss_source_id
+		  FROM rss_source
+		 WHERE lowered_source_name = ?
+	`, strings.ToLower(p.SourceName))
+
+	err := tx.QueryRow(pq.Query, pq.Args...).Scan(&sourceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var conditions []string
+
+	expired := expiredItems{
+		SourceID: sourceID,
+		Args:     []interface{}{sourceID},
+	}
+
+	if p.KeepDays > 0 {
+		conditions = append(conditions, "rss_date < ?")
+		expired.Args = append(expired.Args, time.Now().UTC().AddDate(0, 0, -p.KeepDays))
+	}
+
+	if p.KeepItems > 0 {
+		// the newest item past the ones kept
+		var lastDate time.Time
+		var lastID int64
+
+		paging, pagingArgs := pagingClause(1, p.KeepItems)
+
+		pq = dbutl.PQuery(`
+			SELECT rss_date,
+			       rss_id
+			  FROM rss
+			 WHERE rss_source_id = ?
+			 ORDER BY rss_date DESC, rss_id DESC
+		`+paging, append([]interface{}{sourceID}, pagingArgs...)...)
+
+		err = tx.QueryRow(pq.Query, pq.Args...).Scan(&lastDate, &lastID)
+		if err == nil {
+			conditions = append(conditions, "(rss_date < ? OR (rss_date = ? AND rss_id <= ?))")
+			expired.Args = append(expired.Args, lastDate, lastDate, lastID)
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	expired.Where = " WHERE rss_source_id = ? AND (" + strings.Join(conditions, " OR ") + ")"
+
+	return &expired, nil
+}
+
+// expiredAlerts - the alerts of the expired items, by rss_id
+func expiredAlerts(tx *sql.Tx, expired *expiredItems) (map[int64][]*archivedAlert, error) {
+	alerts := make(map[int64][]*archivedAlert)
+
+	pq := dbutl.PQuery(`
+		SELECT rss_alert_id,
+		       rss_id,
+		       rule_name,
+		       coalesce(matched, '') matched,
+		       notified,
+		       add_date
+		  FROM rss_alert
+		 WHERE rss_id IN (
+			SELECT rss_id
+			  FROM rss
+			`+expired.Where+`
+		 )
+		 ORDER BY rss_alert_id
+	`, expired.Args...)
+
+	err := dbutl.ForEachRowTx(tx, pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		alert := archivedAlert{}
+		if err := sc.Scan(dbutl, row, &alert); err != nil {
+			return err
+		}
+
+		alerts[alert.RssID] = append(alerts[alert.RssID], &alert)
+
+		return nil
+	})
+
+	return alerts, err
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// exportExpired - write the expired items to a gzipped JSON lines file
+func (p *retentionPolicy) exportExpired(tx *sql.Tx, expired *expiredItems) error {
+	dir := config.ArchiveDir
+	if len(dir) == 0 {
+		dir = filepath.Join(currentDir, "archive")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	fileName := filepath.Join(dir, fmt.Sprintf("rss-%s-%s.jsonl.gz",
+		strings.ToLower(unsafeFileChars.ReplaceAllString(p.SourceName, "_")),
+		time.Now().UTC().Format("20060102-150405")))
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	alerts, err := expiredAlerts(tx, expired)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+
+	pq := dbutl.PQuery(`
+		SELECT rss_id,
+		       rss_source_id,
+		       title,
+		       coalesce(link, '') link,
+		       coalesce(description, '') description,
+		       coalesce(item_guid, '') item_guid,
+		       coalesce(orig_link, '') orig_link,
+		       rss_date,
+		       add_date,
+		       coalesce(keywords, '') keywords,
+		       coalesce(category, '') category,
+		       coalesce(subcategory, '') subcategory,
+		       coalesce(content, '') content,
+		       coalesce(tags, '') tags,
+		       coalesce(creator, '') creator,
+		       coalesce(enclosure_link, '') enclosure_link,
+		       coalesce(enclosure_length, 0) enclosure_length,
+		       coalesce(enclosure_filetype, '') enclosure_filetype,
+		       coalesce(media_link, '') media_link,
+		       coalesce(media_filetype, '') media_filetype,
+		       coalesce(media_thumbnail, '') media_thumbnail,
+		       coalesce(item_key, '') item_key,
+		       coalesce(content_hash, '') content_hash,
+		       coalesce(article_content, '') article_content,
+		       coalesce(detected_language, '') detected_language,
+		       coalesce(cluster_id, 0) cluster_id
+		  FROM rss
+	`+expired.Where+`
+		 ORDER BY rss_date, rss_id
+	`, expired.Args...)
+
+	err = dbutl.ForEachRowTx(tx, pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		item := archivedRss{}
+		if err := sc.Scan(dbutl, row, &item); err != nil {
+			return err
+		}
+
+		return enc.Encode(&archivedItem{archivedRss: &item, Alerts: alerts[item.RssID]})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err = gz.Close(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/geo-stanciu/go-utils/utils"
+)
+
+// Full-text search uses the native facility of each database:
+//   - postgres: rss.search_vector (tsvector), kept up to date by a trigger,
+//     stemmed with the text search config matching the detected language
+//     of the item (rss_source.language if unknown)
+//   - mysql: FULLTEXT index on (title, description, content)
+//   - sqlite3: rss_fts FTS5 table, kept up to date by triggers
+//
+// MySQL and SQLite have no per-language stemming, so the language is only
+// used for stemming on PostgreSQL. On every database -lang also keeps only
+// the items in that language.
+
+// searchResult - ranked search result
+type searchResult struct {
+	RssID   int64     `sql:"rss_id"`
+	Source  string    `sql:"source_name"`
+	Title   string    `sql:"title"`
+	Link    string    `sql:"link"`
+	RssDate time.Time `sql:"rss_date"`
+	Rank    float64   `sql:"score"`
+}
+
+func searchIndexCommand(args []string) error {
+	fs := flag.NewFlagSet("search-index", flag.ContinueOnError)
+	rebuildPtr := fs.Bool("rebuild", false, "reindex all the items, not only the missing ones")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var pq *utils.PreparedQuery
+
+	switch config.DbType {
+	case "postgres":
+		query := `
+			UPDATE rss
+			   SET search_vector = rss_search_document(rss_source_id, detected_language, title, description, content)
+		`
+		if !*rebuildPtr {
+			query += " WHERE search_vector IS NULL"
+		}
+
+		pq = dbutl.PQuery(query)
+	case "mysql":
+		pq = dbutl.PQuery(`
+			CREATE FULLTEXT INDEX IF NOT EXISTS idx_rss_search ON rss (title, description, content)
+		`)
+	case "sqlite3":
+		pq = dbutl.PQuery(`
+			INSERT INTO rss_fts (rss_fts) VALUES ('rebuild')
+		`)
+	default:
+		return fmt.Errorf("full-text search is not supported for %s", config.DbType)
+	}
+
+	res, err := dbutl.Exec(pq)
+	if err != nil {
+		return err
+	}
+
+	indexed, _ := res.RowsAffected()
+	audit.Log(nil, "search index", "Index updated.", "rows", indexed)
+
+	return nil
+}
+
+func searchCommand(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	langPtr := fs.String("lang", "", "only items in this language, also the language of the query (postgres)")
+	sourcePtr := fs.String("source", "", "only search this source")
+	limitPtr := fs.Int("limit", 20, "number of results")
+	pagePtr := fs.Int("page", 1, "page of results")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	text := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if len(text) == 0 {
+		return fmt.Errorf("nothing to search for")
+	}
+
+	if *limitPtr < 1 || *pagePtr < 1 {
+		return fmt.Errorf("invalid limit or page")
+	}
+
+	results, err := searchRss(text, *langPtr, *sourcePtr, *limitPtr, (*pagePtr-1)*(*limitPtr))
+	if err != nil {
+		return err
+	}
+
+	for _, res := range results {
+		fmt.Printf("%8.4f  %s  %-20s  %s\n          %s\n",
+			res.Rank,
+			res.RssDate.UTC().Format("2006-01-02 15:04"),
+			res.Source,
+			res.Title,
+			res.Link)
+	}
+
+	audit.Log(nil, "search", "Search done.", "query", text, "results", len(results))
+
+	return nil
+}
+
+// fts5Query - quotes every term so user input is not read as FTS5 syntax
+func fts5Query(text string) string {
+	terms := strings.Fields(text)
+
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// searchRss - items matching the text, best ranked first
+func searchRss(text string, lang string, source string, limit int, offset int) ([]*searchResult, error) {
+	var query string
+	var args []interface{}
+
+	sourceFilter := ""
+	if len(source) > 0 {
+		sourceFilter = " AND s.lowered_source_name = ?"
+	}
+	if len(lang) > 0 {
+		sourceFilter += " AND coalesce(r.detected_language, lower(s.language)) = ?"
+	}
+
+	switch config.DbType {
+	case "postgres":
+		tsquery := "websearch_to_tsquery(rss_search_config(coalesce(r.detected_language, s.language)), ?)"
+		if len(lang) > 0 {
+			tsquery = "websearch_to_tsquery(rss_search_config(?), ?)"
+			args = append(args, lang, text, lang, text)
+		} else {
+			args = append(args, text, text)
+		}
+
+		query = `
+			SELECT r.rss_id,
+			       s.source_name,
+			       r.title,
+			       coalesce(r.link, '') link,
+			       r.rss_date,
+			       ts_rank(r.search_vector, ` + tsquery + `) score
+			  FROM rss r
+			  JOIN rss_source s ON (s.rss_source_id = r.rss_source_id)
+			 WHERE r.search_vector @@ ` + tsquery + sourceFilter + `
+			 ORDER BY score DESC, r.rss_date DESC
+		`
+	case "mysql":
+		args = append(args, text, text)
+
+		query = `
+			SELECT r.rss_id,
+			       s.source_name,
+			       r.title,
+			       coalesce(r.link, '') link,
+			       r.rss_date,
+			       MATCH (r.title, r.description, r.content) AGAINST (? IN NATURAL LANGUAGE MODE) score
+			  FROM rss r
+			  JOIN rss_source s ON (s.rss_source_id = r.rss_source_id)
+			 WHERE MATCH (r.title, r.description, r.content) AGAINST (? IN NATURAL LANGUAGE MODE)
+			 ` + sourceFilter + `
+			 ORDER BY score DESC, r.rss_date DESC
+		`
+	case "sqlite3":
+		args = append(args, fts5Query(text))
+
+		// bm25 is lower for better matches
+		query = `
+			SELECT r.rss_id,
+			       s.source_name,
+			       r.title,
+			       coalesce(r.link, '') link,
+			       r.rss_date,
+			       -bm25(rss_fts) score
+			  FROM rss_fts
+			  JOIN rss r ON (r.rss_id = rss_fts.rowid)
+			  JOIN rss_source s ON (s.rss_source_id = r.rss_source_id)
+			 WHERE rss_fts MATCH ?
+			 ` + sourceFilter + `
+			 ORDER BY score DESC, r.rss_date DESC
+		`
+	default:
+		return nil, fmt.Errorf("full-text search is not supported for %s", config.DbType)
+	}
+
+	if len(source) > 0 {
+		args = append(args, strings.ToLower(source))
+	}
+	if len(lang) > 0 {
+		args = append(args, strings.ToLower(lang))
+	}
+
+	paging, pagingArgs := pagingClause(limit, offset)
+	args = append(args, pagingArgs...)
+
+	pq := dbutl.PQuery(query+paging, args...)
+
+	var results []*searchResult
+
+	err := dbutl.ForEachRow(pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		res := searchResult{}
+		if err := sc.Scan(dbutl, row, &res); err != nil {
+			return err
+		}
+
+		results = append(results, &res)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
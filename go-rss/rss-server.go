@@ -0,0 +1,711 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/geo-stanciu/go-utils/utils"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// outItem - item as read for the outbound feeds
+type outItem struct {
+	RssID        int64     `sql:"rss_id"`
+	Source       string    `sql:"source_name"`
+	SourceLink   string    `sql:"source_link"`
+	Language     string    `sql:"language"`
+	Title        string    `sql:"title"`
+	Link         string    `sql:"link"`
+	Description  string    `sql:"description"`
+	Content      string    `sql:"content"`
+	ItemGUID     string    `sql:"item_guid"`
+	Category     string    `sql:"category"`
+	Creator      string    `sql:"creator"`
+	EnclosureURL string    `sql:"enclosure_link"`
+	EnclosureLen int64     `sql:"enclosure_length"`
+	EnclosureTyp string    `sql:"enclosure_filetype"`
+	RssDate      time.Time `sql:"rss_date"`
+	UpdateDate   time.Time `sql:"update_date"`
+}
+
+// feedFilter - filters and paging of an outbound feed request
+type feedFilter struct {
+	Sources  []string
+	Language string
+	Category string
+	From     time.Time
+	To       time.Time
+	Page     int
+	PageSize int
+}
+
+// feedPage - one page of an outbound feed
+type feedPage struct {
+	Title   string
+	SelfURL string
+	NextURL string
+	PrevURL string
+	Updated time.Time
+	Items   []*outItem
+}
+
+func serveCommand(args []string) error {
+	addr := config.ServerAddress
+	if len(addr) == 0 {
+		addr = ":8080"
+	}
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addrPtr := fs.String("addr", addr, "listen address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rss", feedHandler(writeRSS2, "application/rss+xml; charset=utf-8"))
+	mux.HandleFunc("/atom", feedHandler(writeAtom, "application/atom+xml; charset=utf-8"))
+	mux.HandleFunc("/json", feedHandler(writeJSONFeed, "application/feed+json; charset=utf-8"))
+
+	srv := &http.Server{
+		Addr:         *addrPtr,
+		Handler:      mux,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 60 * time.Second,
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	go func() {
+		<-sigs
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		srv.Shutdown(ctx)
+	}()
+
+	audit.Log(nil, "serve rss", "Listening...", "addr", *addrPtr)
+
+	err := srv.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	audit.Log(nil, "serve rss", "Server stopped.")
+
+	return nil
+}
+
+type feedWriter func(buf *bytes.Buffer, page *feedPage) error
+
+func feedHandler(write feedWriter, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		filter, err := parseFeedFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := getFeedPage(filter)
+		if err != nil {
+			audit.Log(err, "serve rss", "query failed", "url", r.URL.String())
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		page.setURLs(r, filter)
+
+		var buf bytes.Buffer
+		if err = write(&buf, page); err != nil {
+			audit.Log(err, "serve rss", "write failed", "url", r.URL.String())
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		sum := sha1.Sum(buf.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+		w.Header().Set("ETag", etag)
+		if len(page.NextURL) > 0 {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, page.NextURL))
+		}
+		if len(page.PrevURL) > 0 {
+			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="prev"`, page.PrevURL))
+		}
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+
+		if r.Method == http.MethodGet {
+			w.Write(buf.Bytes())
+		}
+	}
+}
+
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseDateParam - accepts 2006-01-02 or RFC 3339 dates
+func parseDateParam(value string) (time.Time, error) {
+	if dt, err := time.Parse("2006-01-02", value); err == nil {
+		return dt, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseFeedFilter(query url.Values) (*feedFilter, error) {
+	var err error
+
+	filter := feedFilter{
+		Language: strings.TrimSpace(query.Get("lang")),
+		Category: strings.TrimSpace(query.Get("category")),
+		Page:     1,
+		PageSize: defaultPageSize,
+	}
+
+	for _, src := range query["source"] {
+		for _, s := range strings.Split(src, ",") {
+			if s = strings.TrimSpace(s); len(s) > 0 {
+				filter.Sources = append(filter.Sources, strings.ToLower(s))
+			}
+		}
+	}
+
+	if from := query.Get("from"); len(from) > 0 {
+		if filter.From, err = parseDateParam(from); err != nil {
+			return nil, fmt.Errorf("invalid from date: %s", from)
+		}
+	}
+
+	if to := query.Get("to"); len(to) > 0 {
+		if filter.To, err = parseDateParam(to); err != nil {
+			return nil, fmt.Errorf("invalid to date: %s", to)
+		}
+
+		// a plain date includes the whole day
+		if len(to) == len("2006-01-02") {
+			filter.To = filter.To.AddDate(0, 0, 1)
+		}
+	}
+
+	if page := query.Get("page"); len(page) > 0 {
+		if filter.Page, err = strconv.Atoi(page); err != nil || filter.Page < 1 {
+			return nil, fmt.Errorf("invalid page: %s", page)
+		}
+	}
+
+	if size := query.Get("page_size"); len(size) > 0 {
+		if filter.PageSize, err = strconv.Atoi(size); err != nil || filter.PageSize < 1 {
+			return nil, fmt.Errorf("invalid page_size: %s", size)
+		}
+
+		if filter.PageSize > maxPageSize {
+			filter.PageSize = maxPageSize
+		}
+	}
+
+	return &filter, nil
+}
+
+// where - conditions of the filter
+func (f *feedFilter) where() (string, []interface{}) {
+	var sb strings.Builder
+	var args []interface{}
+
+	sb.WriteString(" WHERE 1 = 1")
+
+	if len(f.Sources) > 0 {
+		sb.WriteString(" AND s.lowered_source_name IN " + inClause(len(f.Sources)))
+		for _, src := range f.Sources {
+			args = append(args, src)
+		}
+	}
+
+	if len(f.Language) > 0 {
+		sb.WriteString(" AND coalesce(r.detected_language, lower(s.language)) = ?")
+		args = append(args, strings.ToLower(f.Language))
+	}
+
+	if len(f.Category) > 0 {
+		sb.WriteString(" AND lower(r.category) LIKE ?")
+		args = append(args, "%"+strings.ToLower(f.Category)+"%")
+	}
+
+	if !f.From.IsZero() {
+		sb.WriteString(" AND r.rss_date >= ?")
+		args = append(args, f.From.UTC())
+	}
+
+	if !f.To.IsZero() {
+		sb.WriteString(" AND r.rss_date < ?")
+		args = append(args, f.To.UTC())
+	}
+
+	return sb.String(), args
+}
+
+func getFeedPage(filter *feedFilter) (*feedPage, error) {
+	page := feedPage{
+		Title: appName,
+	}
+
+	where, args := filter.where()
+	paging, pagingArgs := pagingClause(filter.PageSize+1, (filter.Page-1)*filter.PageSize)
+	args = append(args, pagingArgs...)
+
+	pq := dbutl.PQuery(`
+		SELECT r.rss_id,
+		       s.source_name,
+		       coalesce(s.source_link, '') source_link,
+		       coalesce(r.detected_language, lower(s.language)) language,
+		       r.title,
+		       coalesce(r.link, '') link,
+		       coalesce(r.description, '') description,
+		       coalesce(r.content, '') content,
+		       coalesce(r.item_guid, '') item_guid,
+		       coalesce(r.category, '') category,
+		       coalesce(r.creator, '') creator,
+		       coalesce(r.enclosure_link, '') enclosure_link,
+		       coalesce(r.enclosure_length, 0) enclosure_length,
+		       coalesce(r.enclosure_filetype, '') enclosure_filetype,
+		       r.rss_date,
+		       coalesce(r.update_date, r.add_date) update_date
+		  FROM rss r
+		  JOIN rss_source s ON (s.rss_source_id = r.rss_source_id)
+		`+where+`
+		 ORDER BY r.rss_date DESC, r.rss_id DESC
+		`+paging, args...)
+
+	err := dbutl.ForEachRow(pq, func(row *sql.Rows, sc *utils.SQLScan) error {
+		item := outItem{}
+		if err := sc.Scan(dbutl, row, &item); err != nil {
+			return err
+		}
+
+		page.Items = append(page.Items, &item)
+
+		if item.UpdateDate.After(page.Updated) {
+			page.Updated = item.UpdateDate
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if page.Updated.IsZero() {
+		page.Updated = time.Now().UTC()
+	}
+
+	if len(filter.Sources) == 1 && len(page.Items) > 0 {
+		page.Title = page.Items[0].Source
+	}
+
+	return &page, nil
+}
+
+// setURLs - self, next and previous page links
+func (p *feedPage) setURLs(r *http.Request, filter *feedFilter) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if fwd := r.Header.Get("X-Forwarded-Proto"); len(fwd) > 0 {
+		scheme = fwd
+	}
+
+	pageURL := func(page int) string {
+		u := url.URL{
+			Scheme: scheme,
+			Host:   r.Host,
+			Path:   r.URL.Path,
+		}
+
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		u.RawQuery = query.Encode()
+
+		return u.String()
+	}
+
+	p.SelfURL = pageURL(filter.Page)
+
+	// one extra row was read to know if there is a next page
+	if len(p.Items) > filter.PageSize {
+		p.Items = p.Items[:filter.PageSize]
+		p.NextURL = pageURL(filter.Page + 1)
+	}
+
+	if filter.Page > 1 {
+		p.PrevURL = pageURL(filter.Page - 1)
+	}
+}
+
+// itemID - stable id of the item in the outbound feeds
+func (i *outItem) itemID() string {
+	if len(i.ItemGUID) > 0 {
+		return i.ItemGUID
+	}
+
+	if len(i.Link) > 0 {
+		return i.Link
+	}
+
+	return fmt.Sprintf("urn:rss:%d", i.RssID)
+}
+
+func (i *outItem) categories() []string {
+	var categories []string
+
+	for _, c := range strings.Split(i.Category, ",") {
+		if c = strings.TrimSpace(c); len(c) > 0 {
+			categories = append(categories, c)
+		}
+	}
+
+	return categories
+}
+
+type rss2Out struct {
+	XMLName xml.Name       `xml:"rss"`
+	Version string         `xml:"version,attr"`
+	AtomNS  string         `xml:"xmlns:atom,attr"`
+	Channel rss2OutChannel `xml:"channel"`
+}
+
+type rss2OutChannel struct {
+	Title         string        `xml:"title"`
+	Link          string        `xml:"link"`
+	Description   string        `xml:"description"`
+	LastBuildDate string        `xml:"lastBuildDate"`
+	Generator     string        `xml:"generator"`
+	AtomLinks     []atomOutLink `xml:"atom:link"`
+	Items         []rss2OutItem `xml:"item"`
+}
+
+type rss2OutGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rss2OutSource struct {
+	URL  string `xml:"url,attr,omitempty"`
+	Name string `xml:",chardata"`
+}
+
+type rss2OutEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rss2OutItem struct {
+	Title       string            `xml:"title"`
+	Link        string            `xml:"link,omitempty"`
+	Description string            `xml:"description,omitempty"`
+	Categories  []string          `xml:"category"`
+	GUID        rss2OutGUID       `xml:"guid"`
+	PubDate     string            `xml:"pubDate"`
+	Source      rss2OutSource     `xml:"source"`
+	Enclosure   *rss2OutEnclosure `xml:"enclosure"`
+}
+
+type atomOutLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomOutText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Text string `xml:",chardata"`
+}
+
+type atomOutCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomOutPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomOutSource struct {
+	Title string        `xml:"title"`
+	Links []atomOutLink `xml:"link"`
+}
+
+type atomOutEntry struct {
+	ID         string            `xml:"id"`
+	Title      atomOutText       `xml:"title"`
+	Updated    string            `xml:"updated"`
+	Published  string            `xml:"published"`
+	Links      []atomOutLink     `xml:"link"`
+	Authors    []atomOutPerson   `xml:"author"`
+	Categories []atomOutCategory `xml:"category"`
+	Summary    *atomOutText      `xml:"summary"`
+	Content    *atomOutText      `xml:"content"`
+	Source     atomOutSource     `xml:"source"`
+}
+
+type atomOutFeed struct {
+	XMLName   xml.Name       `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string         `xml:"id"`
+	Title     string         `xml:"title"`
+	Updated   string         `xml:"updated"`
+	Generator string         `xml:"generator"`
+	Links     []atomOutLink  `xml:"link"`
+	Entries   []atomOutEntry `xml:"entry"`
+}
+
+func (p *feedPage) atomLinks() []atomOutLink {
+	links := []atomOutLink{{Rel: "self", Href: p.SelfURL}}
+
+	if len(p.NextURL) > 0 {
+		links = append(links, atomOutLink{Rel: "next", Href: p.NextURL})
+	}
+
+	if len(p.PrevURL) > 0 {
+		links = append(links, atomOutLink{Rel: "previous", Href: p.PrevURL})
+	}
+
+	return links
+}
+
+func writeXML(buf *bytes.Buffer, v interface{}) error {
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(buf)
+	enc.Indent("", "  ")
+
+	return enc.Encode(v)
+}
+
+func writeRSS2(buf *bytes.Buffer, page *feedPage) error {
+	out := rss2Out{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rss2OutChannel{
+			Title:         page.Title,
+			Link:          page.SelfURL,
+			Description:   fmt.Sprintf("Items gathered by %s", appName),
+			LastBuildDate: page.Updated.UTC().Format(time.RFC1123Z),
+			Generator:     appName + " " + appVersion,
+			AtomLinks:     page.atomLinks(),
+		},
+	}
+
+	for _, item := range page.Items {
+		rssItem := rss2OutItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			Categories:  item.categories(),
+			GUID: rss2OutGUID{
+				IsPermaLink: "false",
+				Value:       item.itemID(),
+			},
+			PubDate: item.RssDate.UTC().Format(time.RFC1123Z),
+			Source: rss2OutSource{
+				URL:  item.SourceLink,
+				Name: item.Source,
+			},
+		}
+
+		if len(item.EnclosureURL) > 0 {
+			rssItem.Enclosure = &rss2OutEnclosure{
+				URL:    item.EnclosureURL,
+				Length: item.EnclosureLen,
+				Type:   item.EnclosureTyp,
+			}
+		}
+
+		out.Channel.Items = append(out.Channel.Items, rssItem)
+	}
+
+	return writeXML(buf, &out)
+}
+
+func writeAtom(buf *bytes.Buffer, page *feedPage) error {
+	out := atomOutFeed{
+		ID:        page.SelfURL,
+		Title:     page.Title,
+		Updated:   page.Updated.UTC().Format(time.RFC3339),
+		Generator: appName,
+		Links:     page.atomLinks(),
+	}
+
+	for _, item := range page.Items {
+		entry := atomOutEntry{
+			ID:        item.itemID(),
+			Title:     atomOutText{Type: "text", Text: item.Title},
+			Updated:   item.UpdateDate.UTC().Format(time.RFC3339),
+			Published: item.RssDate.UTC().Format(time.RFC3339),
+			Source: atomOutSource{
+				Title: item.Source,
+			},
+		}
+
+		if len(item.Link) > 0 {
+			entry.Links = append(entry.Links, atomOutLink{Rel: "alternate", Href: item.Link})
+		}
+
+		if len(item.EnclosureURL) > 0 {
+			entry.Links = append(entry.Links, atomOutLink{
+				Rel:    "enclosure",
+				Type:   item.EnclosureTyp,
+				Href:   item.EnclosureURL,
+				Length: item.EnclosureLen,
+			})
+		}
+
+		if len(item.SourceLink) > 0 {
+			entry.Source.Links = append(entry.Source.Links, atomOutLink{Href: item.SourceLink})
+		}
+
+		if len(item.Creator) > 0 {
+			entry.Authors = append(entry.Authors, atomOutPerson{Name: item.Creator})
+		} else {
+			entry.Authors = append(entry.Authors, atomOutPerson{Name: item.Source})
+		}
+
+		for _, c := range item.categories() {
+			entry.Categories = append(entry.Categories, atomOutCategory{Term: c})
+		}
+
+		if len(item.Description) > 0 {
+			entry.Summary = &atomOutText{Type: "html", Text: item.Description}
+		}
+
+		if len(item.Content) > 0 {
+			entry.Content = &atomOutText{Type: "html", Text: item.Content}
+		}
+
+		out.Entries = append(out.Entries, entry)
+	}
+
+	return writeXML(buf, &out)
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size_in_bytes,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html,omitempty"`
+	Summary       string               `json:"summary,omitempty"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	Language      string               `json:"language,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+	Source        string               `json:"_source"`
+}
+
+type jsonFeed struct {
+	Version string         `json:"version"`
+	Title   string         `json:"title"`
+	FeedURL string         `json:"feed_url"`
+	NextURL string         `json:"next_url,omitempty"`
+	Items   []jsonFeedItem `json:"items"`
+}
+
+func writeJSONFeed(buf *bytes.Buffer, page *feedPage) error {
+	out := jsonFeed{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   page.Title,
+		FeedURL: page.SelfURL,
+		NextURL: page.NextURL,
+		Items:   []jsonFeedItem{},
+	}
+
+	for _, item := range page.Items {
+		jsonItem := jsonFeedItem{
+			ID:            item.itemID(),
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   item.Content,
+			Summary:       item.Description,
+			DatePublished: item.RssDate.UTC().Format(time.RFC3339),
+			DateModified:  item.UpdateDate.UTC().Format(time.RFC3339),
+			Tags:          item.categories(),
+			Language:      strings.ToLower(item.Language),
+			Source:        item.Source,
+		}
+
+		// content_html or content_text is required
+		if len(jsonItem.ContentHTML) == 0 {
+			jsonItem.ContentHTML = item.Description
+		}
+
+		if len(item.Creator) > 0 {
+			jsonItem.Authors = []jsonFeedAuthor{{Name: item.Creator}}
+		}
+
+		if len(item.EnclosureURL) > 0 {
+			jsonItem.Attachments = []jsonFeedAttachment{{
+				URL:      item.EnclosureURL,
+				MimeType: item.EnclosureTyp,
+				Size:     item.EnclosureLen,
+			}}
+		}
+
+		out.Items = append(out.Items, jsonItem)
+	}
+
+	enc := json.NewEncoder(buf)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(&out)
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Besides the rss table, the new items are published to the Sinks of the
+// config once their feed is saved. With StoreInDatabase false the items
+// only go to the sinks: rss_source still keeps the last item date of each
+// source, and rss_published the keys of the items published, so the same
+// items - the ones without a date too - are not published again.
+
+// sinkConfig - where the new items are published
+type sinkConfig struct {
+	Name    string            `json:"Name"`
+	Type    string            `json:"Type"`
+	Path    string            `json:"Path"`
+	URL     string            `json:"URL"`
+	Headers map[string]string `json:"Headers"`
+	Address string            `json:"Address"`
+	Subject string            `json:"Subject"`
+	Sources []string          `json:"Sources"`
+}
+
+// rssEvent - new item, as published to the sinks
+type rssEvent struct {
+	RssID       int64     `json:"rss_id,omitempty"`
+	Source      string    `json:"source"`
+	Language    string    `json:"language"`
+	Title       string    `json:"title"`
+	Link        string    `json:"link"`
+	Description string    `json:"description,omitempty"`
+	Content     string    `json:"content,omitempty"`
+	GUID        string    `json:"guid,omitempty"`
+	Category    string    `json:"category,omitempty"`
+	Creator     string    `json:"creator,omitempty"`
+	Enclosure   string    `json:"enclosure,omitempty"`
+	ItemKey     string    `json:"item_key"`
+	RssDate     time.Time `json:"rss_date"`
+	AddDate     time.Time `json:"add_date"`
+}
+
+// Sink - receives the new items
+type Sink interface {
+	Publish(event *rssEvent) error
+	Close() error
+}
+
+type configuredSink struct {
+	Name    string
+	Sources []string
+	Sink
+}
+
+var sinks []configuredSink
+
+// days the key of a published item is kept once it left its feed
+const publishedKeepDays = 30
+
+// storeInDatabase - the new items are saved in the rss table (default true)
+func storeInDatabase() bool {
+	return config.StoreInDatabase == nil || *config.StoreInDatabase
+}
+
+// markPublished - remember the item published to the sinks, true if it
+// already was (the item_key of the rss table, when it is not stored)
+func (r *RssFeed) markPublished(tx *sql.Tx, rss *RssItem, dt time.Time) (bool, error) {
+	found := 0
+
+	pq := dbutl.PQuery(`
+		SELECT count(*)
+		  FROM rss_published
+		 WHERE rss_source_id = ?
+		   AND item_key = ?
+	`, r.SourceID,
+		rss.ItemKey)
+
+	if err := tx.QueryRow(pq.Query, pq.Args...).Scan(&found); err != nil {
+		return false, err
+	}
+
+	if found > 0 {
+		pq = dbutl.PQuery(`
+			UPDATE rss_published
+			   SET last_seen = ?
+			 WHERE rss_source_id = ?
+			   AND item_key = ?
+		`, dt,
+			r.SourceID,
+			rss.ItemKey)
+	} else {
+		pq = dbutl.PQuery(`
+			INSERT INTO rss_published (
+				rss_source_id,
+				item_key,
+				last_seen
+			)
+			VALUES (?, ?, ?)
+		`, r.SourceID,
+			rss.ItemKey,
+			dt)
+	}
+
+	if _, err := dbutl.ExecTx(tx, pq); err != nil {
+		return false, err
+	}
+
+	return found > 0, nil
+}
+
+// prunePublished - forget the items of the source not seen for publishedKeepDays
+func (r *RssFeed) prunePublished(tx *sql.Tx, dt time.Time) error {
+	pq := dbutl.PQuery(`
+		DELETE FROM rss_published
+		 WHERE rss_source_id = ?
+		   AND last_seen < ?
+	`, r.SourceID,
+		dt.AddDate(0, 0, -publishedKeepDays))
+
+	_, err := dbutl.ExecTx(tx, pq)
+
+	return err
+}
+
+// prepareSinks - create the sinks of the config
+func prepareSinks() error {
+	for _, cfg := range config.Sinks {
+		s, err := newSink(cfg)
+		if err != nil {
+			return err
+		}
+
+		sinks = append(sinks, configuredSink{Name: cfg.Name, Sources: cfg.Sources, Sink: s})
+	}
+
+	if !storeInDatabase() && len(sinks) == 0 {
+		return fmt.Errorf("StoreInDatabase is false and no sink is configured")
+	}
+
+	return nil
+}
+
+func newSink(cfg sinkConfig) (Sink, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "jsonl", "file":
+		if len(cfg.Path) == 0 {
+			return nil, fmt.Errorf("sink %s: no Path", cfg.Name)
+		}
+
+		return &jsonlSink{Path: cfg.Path}, nil
+	case "webhook":
+		if len(cfg.URL) == 0 {
+			return nil, fmt.Errorf("sink %s: no URL", cfg.Name)
+		}
+
+		return &webhookSink{URL: cfg.URL, Headers: cfg.Headers}, nil
+	case "nats":
+		address := cfg.Address
+		if len(address) == 0 {
+			address = "127.0.0.1:4222"
+		}
+
+		subject := cfg.Subject
+		if len(subject) == 0 {
+			subject = "rss.items"
+		}
+
+		return &natsSink{Address: address, Subject: subject}, nil
+	}
+
+	return nil, fmt.Errorf("sink %s: unknown type %s", cfg.Name, cfg.Type)
+}
+
+func closeSinks() {
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			audit.Log(err, "sinks", "close failed", "sink", s.Name)
+		}
+	}
+
+	sinks = nil
+}
+
+// publishItems - send the items inserted by Save to the sinks
+func publishItems(feed *RssFeed) {
+	if len(sinks) == 0 {
+		return
+	}
+
+	dt := time.Now().UTC()
+
+	for _, rss := range feed.Inserted {
+		event := rssEvent{
+			RssID:       rss.RssID,
+			Source:      feed.Source,
+			Language:    itemLanguage(rss.DetectedLanguage, feed.Language),
+			Title:       strings.TrimSpace(rss.Title),
+			Link:        strings.TrimSpace(rss.Link),
+			Description: strings.TrimSpace(rss.Description),
+			Content:     strings.TrimSpace(rss.Content),
+			GUID:        strings.TrimSpace(rss.ItemGUID),
+			Category:    strings.TrimSpace(rss.Category),
+			Creator:     strings.TrimSpace(rss.Creator),
+			Enclosure:   strings.TrimSpace(rss.Enclosure.URL),
+			ItemKey:     rss.ItemKey,
+			RssDate:     rss.RssDate.UTC(),
+			AddDate:     dt,
+		}
+
+		for _, s := range sinks {
+			if len(s.Sources) > 0 && !hasSource(feed.Source, s.Sources) {
+				continue
+			}
+
+			if err := s.Publish(&event); err != nil {
+				audit.Log(err,
+					"sinks",
+					"publish failed",
+					"sink", s.Name,
+					"source", feed.Source,
+					"link", event.Link)
+			}
+		}
+	}
+}
+
+// jsonlSink - append the items as JSON lines.
+// {date} in the path is replaced by the UTC date, for one file per day.
+type jsonlSink struct {
+	sync.Mutex
+	Path string
+	name string
+	file *os.File
+}
+
+// Publish - Sink
+func (s *jsonlSink) Publish(event *rssEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	name := strings.Replace(s.Path, "{date}", time.Now().UTC().Format("2006-01-02"), -1)
+
+	if s.file == nil || s.name != name {
+		if s.file != nil {
+			s.file.Close()
+		}
+
+		s.file, err = os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			s.file = nil
+			return err
+		}
+
+		s.name = name
+	}
+
+	_, err = s.file.Write(append(line, '\n'))
+
+	return err
+}
+
+// Close - Sink
+func (s *jsonlSink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// webhookSink - POST each item as JSON
+type webhookSink struct {
+	URL     string
+	Headers map[string]string
+}
+
+// Publish - Sink
+func (s *webhookSink) Publish(event *rssEvent) error {
+	return postJSON(s.URL, s.Headers, event)
+}
+
+// Close - Sink
+func (s *webhookSink) Close() error {
+	return nil
+}
+
+// natsSink - publish each item with the NATS text protocol (PUB),
+// understood by nats-server and the NATS bridges of other brokers.
+// {source} in the subject is replaced by the lowered source name.
+type natsSink struct {
+	sync.Mutex
+	Address string
+	Subject string
+	conn    net.Conn
+}
+
+var subjectReplacer = strings.NewReplacer(" ", "_", ".", "_", "*", "_", ">", "_", "\t", "_")
+
+// connect - open the connection and start answering the server PINGs
+func (s *natsSink) connect() error {
+	conn, err := net.DialTimeout("tcp", s.Address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if !strings.HasPrefix(line, "INFO") {
+		conn.Close()
+		return fmt.Errorf("%s: not a NATS server: %s", s.Address, strings.TrimSpace(line))
+	}
+
+	_, err = fmt.Fprintf(conn, "CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":%q}\r\n", appName)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.conn = conn
+
+	go s.readLoop(conn, r)
+
+	return nil
+}
+
+func (s *natsSink) readLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			s.Lock()
+			fmt.Fprint(conn, "PONG\r\n")
+			s.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			audit.Log(fmt.Errorf("%s", strings.TrimSpace(line)), "sinks", "nats error", "address", s.Address)
+		}
+	}
+}
+
+// Publish - Sink
+func (s *natsSink) Publish(event *rssEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	subject := strings.Replace(s.Subject, "{source}", subjectReplacer.Replace(strings.ToLower(event.Source)), -1)
+
+	s.Lock()
+	defer s.Unlock()
+
+	// one retry on a new connection, the server may have been restarted
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			if err = s.connect(); err != nil {
+				return err
+			}
+		}
+
+		_, err = fmt.Fprintf(s.conn, "PUB %s %d\r\n%s\r\n", subject, len(payload), payload)
+		if err == nil {
+			return nil
+		}
+
+		s.conn.Close()
+		s.conn = nil
+
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+// Close - Sink
+func (s *natsSink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
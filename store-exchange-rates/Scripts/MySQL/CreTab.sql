@@ -5,10 +5,13 @@ create table if not exists currency (
 );
 
 create table if not exists exchange_rate (
+    provider              varchar(16)    not null,
+    base_currency         varchar(8)     not null,
     currency_id           int            not null,
     exchange_date         date           not null,       
-    rate                  numeric(18, 6) not null,
-    constraint exchange_rate_pk primary key (currency_id, exchange_date),
+    rate                  numeric(24, 12) not null,
+    carried               int            default 0 not null,
+    constraint exchange_rate_pk primary key (provider, base_currency, currency_id, exchange_date),
     constraint exchange_rate_currency_fk foreign key (currency_id)
         references currency (currency_id)
 );
@@ -16,6 +19,38 @@ create table if not exists exchange_rate (
 create index if not exists idx_exchange_rate_curr_id on exchange_rate (currency_id);
 create index if not exists idx_exchange_rate_date on exchange_rate (exchange_date);
 
+create table if not exists exchange_cross_rate (
+    provider              varchar(16)    not null,
+    base_currency         varchar(8)     not null,
+    from_currency_id      int            not null,
+    to_currency_id        int            not null,
+    exchange_date         date           not null,
+    rate                  numeric(28, 12)not null,
+    constraint exchange_cross_rate_pk primary key (provider, base_currency, from_currency_id, to_currency_id, exchange_date),
+    constraint exchange_cross_rate_from_fk foreign key (from_currency_id)
+        references currency (currency_id),
+    constraint exchange_cross_rate_to_fk foreign key (to_currency_id)
+        references currency (currency_id)
+);
+
+create index if not exists idx_exchange_cross_rate_date on exchange_cross_rate (exchange_date);
+
+create table if not exists exchange_rate_revision (
+    revision_id           bigint auto_increment primary key,
+    provider              varchar(16)    not null,
+    base_currency         varchar(8)     not null,
+    currency_id           int            not null,
+    exchange_date         date           not null,
+    old_rate              numeric(24, 12) null,
+    new_rate              numeric(24, 12) not null,
+    detected_time         datetime(3)    not null,
+    applied               int            default 0 not null,
+    constraint exchange_rate_revision_fk foreign key (currency_id)
+        references currency (currency_id)
+);
+
+create index if not exists idx_exchange_rate_revision on exchange_rate_revision (provider, base_currency, currency_id, exchange_date);
+
 create table if not exists audit_log (
     audit_log_id   bigint auto_increment PRIMARY KEY,
     source         varchar(64) not null,
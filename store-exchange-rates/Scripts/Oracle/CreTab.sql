@@ -7,10 +7,13 @@ create table currency (
 );
 
 create table exchange_rate (
+    provider              varchar2(16)  not null,
+    base_currency         varchar2(8)   not null,
     currency_id           number        not null,
     exchange_date         date          not null,       
-    rate                  number(18, 6) not null,
-    constraint exchange_rate_pk primary key (currency_id, exchange_date),
+    rate                  number(24, 12) not null,
+    carried               number         default 0 not null,
+    constraint exchange_rate_pk primary key (provider, base_currency, currency_id, exchange_date),
     constraint exchange_rate_currency_fk foreign key (currency_id)
         references currency (currency_id)
 );
@@ -18,6 +21,40 @@ create table exchange_rate (
 create index idx_exchange_rate_curr_id on exchange_rate (currency_id);
 create index idx_exchange_rate_date on exchange_rate (exchange_date);
 
+create table exchange_cross_rate (
+    provider              varchar2(16)   not null,
+    base_currency         varchar2(8)    not null,
+    from_currency_id      number         not null,
+    to_currency_id        number         not null,
+    exchange_date         date           not null,
+    rate                  number(28, 12) not null,
+    constraint exchange_cross_rate_pk primary key (provider, base_currency, from_currency_id, to_currency_id, exchange_date),
+    constraint exchange_cross_rate_from_fk foreign key (from_currency_id)
+        references currency (currency_id),
+    constraint exchange_cross_rate_to_fk foreign key (to_currency_id)
+        references currency (currency_id)
+);
+
+create index idx_exchange_cross_rate_date on exchange_cross_rate (exchange_date);
+
+create sequence s$exchange_rate_revision nocache start with 1;
+
+create table exchange_rate_revision (
+    revision_id           number default s$exchange_rate_revision.nextval primary key,
+    provider              varchar2(16)   not null,
+    base_currency         varchar2(8)    not null,
+    currency_id           number         not null,
+    exchange_date         date           not null,
+    old_rate              number(24, 12) null,
+    new_rate              number(24, 12) not null,
+    detected_time         timestamp      not null,
+    applied               number         default 0 not null,
+    constraint exchange_rate_revision_fk foreign key (currency_id)
+        references currency (currency_id)
+);
+
+create index idx_exchange_rate_revision on exchange_rate_revision (provider, base_currency, currency_id, exchange_date);
+
 create sequence s$audit_log nocache start with 1;
 
 create table audit_log (
@@ -0,0 +1,24 @@
+-- Upgrades a database created by an earlier CreTab.sql: the columns added
+-- to exchange_rate and its new primary key. The rates already stored are
+-- the BNR ones, in RON. Run it once, then the create statements of
+-- CreTab.sql for the tables the database does not have yet.
+
+alter table exchange_rate add (
+    provider      varchar2(16) default 'BNR' not null,
+    base_currency varchar2(8)  default 'RON' not null
+);
+
+update exchange_rate set provider = 'BNR' where provider is null;
+update exchange_rate set base_currency = 'RON' where base_currency is null;
+commit;
+
+alter table exchange_rate modify (provider default null, base_currency default null);
+
+alter table exchange_rate drop constraint exchange_rate_pk drop index;
+alter table exchange_rate add constraint exchange_rate_pk primary key (provider, base_currency, currency_id, exchange_date);
+
+-- 12 decimals, for the inverted quotes of the weak currencies (ECB)
+alter table exchange_rate modify (rate number(24, 12));
+
+-- carried forward rates (check -fill), once
+alter table exchange_rate add (carried number default 0 not null);
@@ -0,0 +1,22 @@
+-- Upgrades a database created by an earlier CreTab.sql: the columns added
+-- to exchange_rate and its new primary key. The rates already stored are
+-- the BNR ones, in RON. Run it before CreTab.sql, which then creates the
+-- new tables. Safe to run again.
+
+alter table exchange_rate add column if not exists provider      varchar(16) default 'BNR' not null;
+alter table exchange_rate add column if not exists base_currency varchar(8)  default 'RON' not null;
+
+update exchange_rate set provider = 'BNR' where provider is null;
+update exchange_rate set base_currency = 'RON' where base_currency is null;
+
+alter table exchange_rate alter column provider drop default;
+alter table exchange_rate alter column base_currency drop default;
+
+alter table exchange_rate drop constraint if exists exchange_rate_pk;
+alter table exchange_rate add constraint exchange_rate_pk primary key (provider, base_currency, currency_id, exchange_date);
+
+-- 12 decimals, for the inverted quotes of the weak currencies (ECB)
+alter table exchange_rate alter column rate type numeric(24, 12);
+
+-- carried forward rates (check -fill)
+alter table exchange_rate add column if not exists carried       int         default 0     not null;
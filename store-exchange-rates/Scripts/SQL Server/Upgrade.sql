@@ -0,0 +1,41 @@
+-- Upgrades a database created by an earlier CreTab.sql: the columns added
+-- to exchange_rate and its new primary key. The rates already stored are
+-- the BNR ones, in RON. Safe to run again. Then run the create statements
+-- of CreTab.sql for the tables the database does not have yet.
+
+if col_length('exchange_rate', 'provider') is null
+    alter table exchange_rate add provider varchar(16) not null
+        constraint exchange_rate_provider_df default 'BNR' with values;
+if col_length('exchange_rate', 'base_currency') is null
+    alter table exchange_rate add base_currency varchar(8) not null
+        constraint exchange_rate_base_currency_df default 'RON' with values;
+go
+
+if object_id('exchange_rate_provider_df') is not null
+    alter table exchange_rate drop constraint exchange_rate_provider_df;
+if object_id('exchange_rate_base_currency_df') is not null
+    alter table exchange_rate drop constraint exchange_rate_base_currency_df;
+go
+
+if not exists (
+    select 1
+      from sys.index_columns ic
+      join sys.indexes i on (i.object_id = ic.object_id and i.index_id = ic.index_id)
+      join sys.columns c on (c.object_id = ic.object_id and c.column_id = ic.column_id)
+     where i.name = 'exchange_rate_pk'
+       and c.name = 'provider'
+)
+begin
+    alter table exchange_rate drop constraint exchange_rate_pk;
+    alter table exchange_rate add constraint exchange_rate_pk primary key (provider, base_currency, currency_id, exchange_date);
+end
+go
+
+-- 12 decimals, for the inverted quotes of the weak currencies (ECB)
+alter table exchange_rate alter column rate numeric(24, 12) not null;
+go
+
+-- carried forward rates (check -fill)
+if col_length('exchange_rate', 'carried') is null
+    alter table exchange_rate add carried int not null default 0;
+go
@@ -0,0 +1,39 @@
+-- Upgrades a database created by an earlier CreTab.sql: the columns added
+-- to exchange_rate and its new primary key. The rates already stored are
+-- the BNR ones, in RON. SQLite can not change a primary key, so the table
+-- is copied. Run it once, before CreTab.sql, which then creates the new
+-- tables.
+
+pragma foreign_keys = off;
+
+begin transaction;
+
+create table exchange_rate_new (
+    provider              varchar(16)    not null,
+    base_currency         varchar(8)     not null,
+    currency_id           integer        not null,
+    exchange_date         date           not null,
+    rate                  numeric(24, 12) not null,
+    constraint exchange_rate_pk primary key (provider, base_currency, currency_id, exchange_date),
+    constraint exchange_rate_currency_fk foreign key (currency_id)
+        references currency (currency_id)
+);
+
+insert into exchange_rate_new (provider, base_currency, currency_id, exchange_date, rate)
+select 'BNR', 'RON', currency_id, exchange_date, rate
+  from exchange_rate;
+
+drop table exchange_rate;
+
+alter table exchange_rate_new rename to exchange_rate;
+
+create index if not exists idx_exchange_rate_curr_id on exchange_rate (currency_id);
+create index if not exists idx_exchange_rate_date on exchange_rate (exchange_date);
+
+commit;
+
+pragma foreign_keys = on;
+
+-- carried forward rates (check -fill): run it alone if the table was
+-- already copied above by an earlier upgrade
+alter table exchange_rate add column carried integer default 0 not null;
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BNR publishes one archive file for each year, starting with 2005
+// (YearURL of the other providers)
+const (
+	firstArchiveYear       = 2005
+	defaultRatesYearXMLUrl = "https://www.bnr.ro/files/xml/years/nbrfxrates{year}.xml"
+)
+
+// importStats - what the import added
+type importStats struct {
+	Dates int
+	Rates int
+}
+
+var imported importStats
+
+// parseYearRange - "2005-2021" or "2021"
+func parseYearRange(years string) (int, int, error) {
+	parts := strings.SplitN(strings.TrimSpace(years), "-", 2)
+
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid year range: %s", years)
+	}
+
+	to := from
+	if len(parts) == 2 {
+		to, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid year range: %s", years)
+		}
+	}
+
+	if from > to || from < firstArchiveYear || to > time.Now().Year() {
+		return 0, 0, fmt.Errorf("invalid year range: %s (archives exist for %d-%d)",
+			years,
+			firstArchiveYear,
+			time.Now().Year())
+	}
+
+	return from, to, nil
+}
+
+func yearSource(template string, year int) string {
+	return strings.Replace(template, "{year}", strconv.Itoa(year), -1)
+}
+
+// backfill - import the yearly archives of the range, from the YearURL of
+// the provider or from the files of fromFile ({year} in the name is
+// replaced by the year)
+func backfill(years string, fromFile string) error {
+	from, to, err := parseYearRange(years)
+	if err != nil {
+		return err
+	}
+
+	urlTemplate := provider.YearURL
+	if len(urlTemplate) == 0 && len(fromFile) == 0 {
+		return fmt.Errorf("provider %s has no yearly archives (YearURL), use -from-file", provider.Name)
+	}
+
+	if len(fromFile) > 0 && from != to && !strings.Contains(fromFile, "{year}") {
+		return fmt.Errorf("-from-file needs {year} in the name to backfill more years")
+	}
+
+	// the stored dates are skipped by storeRate, older years must not be
+	lastExchangeRate = time.Time{}
+
+	var total importStats
+	var failed []string
+
+	for year := from; year <= to; year++ {
+		imported = importStats{}
+
+		if len(fromFile) > 0 {
+			err = getStreamFromFile(yearSource(fromFile, year), parseSource)
+		} else {
+			err = getStreamFromURL(yearSource(urlTemplate, year), parseSource)
+		}
+
+		if err != nil {
+			failed = append(failed, strconv.Itoa(year))
+			audit.Log(err, "backfill exchange rates", "year failed", "year", year)
+			continue
+		}
+
+		total.Dates += imported.Dates
+		total.Rates += imported.Rates
+
+		audit.Log(nil,
+			"backfill exchange rates",
+			"year imported",
+			"provider", provider.Name,
+			"year", year,
+			"dates", imported.Dates,
+			"rates", imported.Rates)
+	}
+
+	audit.Log(nil,
+		"backfill exchange rates",
+		"Backfill done.",
+		"years", years,
+		"dates", total.Dates,
+		"rates", total.Rates)
+
+	if len(failed) > 0 {
+		return fmt.Errorf("backfill failed for: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
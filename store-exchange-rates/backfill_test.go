@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseYearRange(t *testing.T) {
+	thisYear := time.Now().Year()
+
+	tests := []struct {
+		years    string
+		wantFrom int
+		wantTo   int
+		wantErr  bool
+	}{
+		{"2021", 2021, 2021, false},
+		{" 2005 - 2010 ", 2005, 2010, false},
+		{"2005-" + strconv.Itoa(thisYear), 2005, thisYear, false},
+		{"2004", 0, 0, true},
+		{"2004-2010", 0, 0, true},
+		{"2010-2005", 0, 0, true},
+		{"2010-" + strconv.Itoa(thisYear+1), 0, 0, true},
+		{"", 0, 0, true},
+		{"abc", 0, 0, true},
+		{"2010-", 0, 0, true},
+		{"2010-x", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		from, to, err := parseYearRange(tt.years)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseYearRange(%q) error = %v, want error %v", tt.years, err, tt.wantErr)
+			continue
+		}
+
+		if from != tt.wantFrom || to != tt.wantTo {
+			t.Errorf("parseYearRange(%q) = %d, %d, want %d, %d", tt.years, from, to, tt.wantFrom, tt.wantTo)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"store-exchange-rates/rates"
+)
+
+// The check walks the stored rates of the provider, currency by currency,
+// and reports the business days (of the HolidayCalendar) without a fixing,
+// from the first fixing of the currency to its last one - or to -until
+// (default: the last fixing imported) while the provider still publishes it. With -fill the missing days get
+// the previous rate of the currency, stored with carried = 1; a fixing
+// imported later for the same day replaces the carried rate.
+
+// newCalendar - calendar of the business days, from the config
+func newCalendar() (*rates.Calendar, error) {
+	return rates.NewCalendar(config.HolidayCalendar, config.Holidays)
+}
+
+// checkCommand - report (and fill) the missing fixings from date until
+// until (default: from the first fixing, until the last fixing imported)
+func checkCommand(date string, until string, fill bool) error {
+	calendar, err := newCalendar()
+	if err != nil {
+		return err
+	}
+
+	var from time.Time
+	if len(strings.TrimSpace(date)) > 0 {
+		if from, err = parseDate(date); err != nil {
+			return err
+		}
+	}
+
+	// the fixing of today may not be published yet
+	var to time.Time
+	if len(strings.TrimSpace(until)) > 0 {
+		to, err = parseDate(until)
+	} else {
+		to, err = getLastExchangeRate()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	from = truncateDay(from)
+	to = truncateDay(to)
+
+	stored, err := getStoredRates(time.Time{}, to)
+	if err != nil {
+		return err
+	}
+
+	gaps := rates.FindGaps(stored, calendar, from, to)
+
+	byCurrency := make(map[string][]string)
+	var currencies []string
+
+	for _, g := range gaps {
+		if _, ok := byCurrency[g.Currency]; !ok {
+			currencies = append(currencies, g.Currency)
+		}
+
+		byCurrency[g.Currency] = append(byCurrency[g.Currency], g.Date.Format("2006-01-02"))
+	}
+
+	for _, currency := range currencies {
+		fmt.Printf("%s: %d missing fixings: %s\n",
+			currency,
+			len(byCurrency[currency]),
+			strings.Join(byCurrency[currency], ", "))
+	}
+
+	audit.Log(nil,
+		"check exchange rates",
+		"Check done.",
+		"provider", provider.Name,
+		"calendar", calendar.Name,
+		"currencies", len(currencies),
+		"missing", len(gaps))
+
+	if len(gaps) == 0 {
+		fmt.Printf("%s: no missing fixings\n", provider.Name)
+		return nil
+	}
+
+	if !fill {
+		return fmt.Errorf("%d missing fixings of %s (-fill carries the previous rates forward)", len(gaps), provider.Name)
+	}
+
+	if err = fillGaps(gaps); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d missing fixings carried forward\n", len(gaps))
+
+	return nil
+}
+
+func truncateDay(dt time.Time) time.Time {
+	return time.Date(dt.Year(), dt.Month(), dt.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// getStoredRates - the rates of the provider from the date (from the first
+// fixing if zero) until the date, by currency and date
+func getStoredRates(from time.Time, until time.Time) ([]rates.Fixing, error) {
+	pq := dbutl.PQuery(`
+		SELECT c.currency_id,
+		       c.currency,
+		       r.exchange_date,
+		       r.rate,
+		       r.carried
+		  FROM exchange_rate r
+		  JOIN currency c ON (r.currency_id = c.currency_id)
+		 WHERE r.provider = ?
+		   AND r.base_currency = ?
+		   AND c.currency <> ?
+		   AND r.exchange_date >= DATE ?
+		   AND r.exchange_date <= DATE ?
+		 ORDER BY c.currency, r.exchange_date
+	`, provider.Name,
+		provider.BaseCurrency,
+		provider.BaseCurrency,
+		from.Format("2006-01-02"),
+		until.Format("2006-01-02"))
+
+	rows, err := db.Query(pq.Query, pq.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stored []rates.Fixing
+
+	for rows.Next() {
+		var r rates.Fixing
+		var carried int
+
+		if err = rows.Scan(&r.CurrencyID, &r.Currency, &r.Date, &r.Rate, &carried); err != nil {
+			return nil, err
+		}
+
+		r.Date = truncateDay(r.Date)
+		r.Carried = carried == 1
+		stored = append(stored, r)
+	}
+
+	return stored, rows.Err()
+}
+
+// fillGaps - store the previous rates on the missing days, as carried
+func fillGaps(gaps []rates.Gap) error {
+	tx, err := dbutl.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer dbutl.Rollback(tx)
+
+	dates := make(map[string]bool)
+
+	for _, g := range gaps {
+		date := g.Date.Format("2006-01-02")
+
+		if err = insertCarriedRate(tx, g.CurrencyID, date, g.Rate); err != nil {
+			return err
+		}
+
+		dates[date] = true
+
+		audit.Log(nil,
+			"check exchange rates",
+			"carried rate forward",
+			"provider", provider.Name,
+			"date", date,
+			"currency", g.Currency,
+			"rate", g.Rate)
+	}
+
+	dbutl.Commit(tx)
+
+	var sorted []string
+	for date := range dates {
+		sorted = append(sorted, date)
+	}
+	sort.Strings(sorted)
+
+	for _, date := range sorted {
+		if err = materializeCrossRates(date); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func insertCarriedRate(tx *sql.Tx, currencyID int32, date string, rate string) error {
+	pq := dbutl.PQuery(`
+		INSERT INTO exchange_rate (
+			provider,
+			base_currency,
+			currency_id,
+			exchange_date,
+			rate,
+			carried
+		)
+		VALUES (?, ?, ?, DATE ?, ?, 1)
+	`, provider.Name,
+		provider.BaseCurrency,
+		currencyID,
+		date,
+		rate)
+
+	_, err := dbutl.ExecTx(tx, pq)
+
+	return err
+}
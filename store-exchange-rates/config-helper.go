@@ -9,7 +9,26 @@ type configuration struct {
 	DbType               string `json:"DbType"`
 	DbURL                string `json:"DbURL"`
 	RatesXMLUrl          string `json:"RatesXMLUrl"`
+	RatesYearXMLUrl      string `json:"RatesYearXMLUrl"`
 	AddMissingCurrencies bool   `json:"AddMissingCurrencies"`
+	// BNR (default), ECB or the name of one of Providers
+	Provider  string           `json:"Provider"`
+	Providers []providerConfig `json:"Providers"`
+	// cross rates: "EUR/USD" pairs, stored after each import if StoreCrossRates
+	CrossPairs []string `json:"CrossPairs"`
+	// decimals of the cross rates, 6 if not set
+	CrossPrecision    *int    `json:"CrossPrecision"`
+	CrossRounding     string  `json:"CrossRounding"`
+	StoreCrossRates   bool    `json:"StoreCrossRates"`
+	CrossValidateWith string  `json:"CrossValidateWith"`
+	CrossTolerancePct float64 `json:"CrossTolerancePct"`
+	// business days of -check: RO (default) or NONE (weekends only),
+	// plus the Holidays, ex: "2021-12-24" once or "12-24" every year
+	HolidayCalendar string   `json:"HolidayCalendar"`
+	Holidays        []string `json:"Holidays"`
+	// business days a rate may be older than the date asked (default 1:
+	// the previous fixing); more for a provider with other holidays
+	RateLookbackDays int `json:"RateLookbackDays"`
 }
 
 func (c *configuration) ReadFromFile(cfgFile string) error {
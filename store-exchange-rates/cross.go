@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"store-exchange-rates/rates"
+)
+
+const defaultCrossTolerancePct = 0.5
+
+var (
+	// reads the rates of the provider, for the queries and the cross rates
+	ratesStore *rates.Store
+	// provider whose published rates check the triangulated cross rates
+	crossValidator *rates.Store
+)
+
+// newRatesStore - store of the provider, with the precision and
+// rounding mode of the cross rates from the config
+func newRatesStore(p *configuredProvider) (*rates.Store, error) {
+	store := rates.NewStore(db, dbutl)
+	store.Provider = p.Name
+	store.Base = p.BaseCurrency
+
+	if config.CrossPrecision != nil {
+		precision := *config.CrossPrecision
+		if precision < 0 || precision > rates.MaxDecimals {
+			return nil, fmt.Errorf("CrossPrecision must be between 0 and %d", rates.MaxDecimals)
+		}
+		store.Precision = precision
+	}
+
+	mode, err := rates.ParseRoundingMode(config.CrossRounding)
+	if err != nil {
+		return nil, err
+	}
+	store.Rounding = mode
+
+	store.Calendar, err = newCalendar()
+	if err != nil {
+		return nil, err
+	}
+	store.LookbackDays = config.RateLookbackDays
+
+	return store, nil
+}
+
+// getCrossValidator - store of the provider checking the cross rates
+// (nil if there is none)
+func getCrossValidator(name string) (*rates.Store, error) {
+	if len(name) == 0 {
+		return nil, nil
+	}
+
+	p, err := getProvider(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Name == provider.Name && p.BaseCurrency == provider.BaseCurrency {
+		return nil, fmt.Errorf("the cross rates of %s can not be validated against itself", p.Name)
+	}
+
+	return newRatesStore(p)
+}
+
+func crossTolerance() *big.Rat {
+	pct := config.CrossTolerancePct
+	if pct <= 0 {
+		pct = defaultCrossTolerancePct
+	}
+
+	tolerance := new(big.Rat).SetFloat64(pct)
+
+	return tolerance.Quo(tolerance, big.NewRat(100, 1))
+}
+
+// crossCommand - print (and store) the cross rates of the pairs on date,
+// or on each fixing date from date to until
+func crossCommand(pairList string, date string, until string, store bool) error {
+	pairs, err := rates.ParsePairs(pairList)
+	if err != nil {
+		return err
+	}
+
+	from, err := parseDate(date)
+	if err != nil {
+		return err
+	}
+
+	dates := []time.Time{from}
+
+	if len(until) > 0 {
+		to, err := parseDate(until)
+		if err != nil {
+			return err
+		}
+
+		dates, err = ratesStore.FixingDates(from, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	mismatches := 0
+
+	for _, dt := range dates {
+		for _, pair := range pairs {
+			c, err := ratesStore.CrossRate(pair, dt)
+			if errors.Is(err, rates.ErrNoRate) {
+				fmt.Printf("%s %s: %v\n", pair, dt.Format("2006-01-02"), err)
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s %s: %s (%s, %s = %s %s, %s = %s %s)\n",
+				pair,
+				dt.Format("2006-01-02"),
+				ratesStore.Text(c.Value),
+				c.Provider,
+				c.From.Currency, rates.FormatRate(c.From.Value), c.Base,
+				c.To.Currency, rates.FormatRate(c.To.Value), c.Base)
+
+			if store {
+				if err = storeCrossRate(c); err != nil {
+					return err
+				}
+			}
+
+			if crossValidator != nil {
+				ok, err := validateCross(c)
+				if err != nil {
+					return err
+				} else if !ok {
+					mismatches++
+				}
+			}
+		}
+	}
+
+	if mismatches > 0 {
+		return fmt.Errorf("%d cross rates differ from the ones published by %s", mismatches, crossValidator.Provider)
+	}
+
+	return nil
+}
+
+// validateCross - the cross rate is close enough to the one published by
+// the validating provider (true if it does not publish the pair)
+func validateCross(c *rates.CrossRate) (bool, error) {
+	published, ok, err := crossValidator.PublishedRate(c.Pair, c.Date)
+	if errors.Is(err, rates.ErrNoRate) || !ok {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	deviation := rates.Deviation(c.Value, published)
+	if deviation.Cmp(crossTolerance()) <= 0 {
+		return true, nil
+	}
+
+	pct := new(big.Rat).Mul(deviation, big.NewRat(100, 1))
+
+	fmt.Printf("    MISMATCH: %s publishes %s, %s%% apart\n",
+		crossValidator.Provider,
+		rates.FormatRate(published),
+		pct.FloatString(3))
+
+	audit.Log(nil,
+		"cross rates",
+		"cross rate mismatch",
+		"pair", c.Pair.String(),
+		"date", c.Date.Format("2006-01-02"),
+		"provider", c.Provider,
+		"cross_rate", ratesStore.Text(c.Value),
+		"published_by", crossValidator.Provider,
+		"published_rate", rates.FormatRate(published),
+		"deviation_pct", pct.FloatString(3))
+
+	return false, nil
+}
+
+// materializeCrossRates - store the CrossPairs of the imported date
+func materializeCrossRates(date string) error {
+	if !config.StoreCrossRates || len(config.CrossPairs) == 0 {
+		return nil
+	}
+
+	pairs, err := rates.ParsePairs(strings.Join(config.CrossPairs, ","))
+	if err != nil {
+		return err
+	}
+
+	dt, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return err
+	}
+
+	for _, pair := range pairs {
+		c, err := ratesStore.CrossRate(pair, dt)
+		if errors.Is(err, rates.ErrNoRate) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if err = storeCrossRate(c); err != nil {
+			return err
+		}
+
+		if crossValidator != nil {
+			if _, err = validateCross(c); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// storeCrossRate - insert or update the cross rate in exchange_cross_rate
+func storeCrossRate(c *rates.CrossRate) error {
+	found := 0
+
+	tx, err := dbutl.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer dbutl.Rollback(tx)
+
+	fromID, err := getCurrencyIfExists(tx, c.Pair.From)
+	if err != nil {
+		return err
+	}
+
+	toID, err := getCurrencyIfExists(tx, c.Pair.To)
+	if err != nil {
+		return err
+	}
+
+	date := c.Date.Format("2006-01-02")
+
+	pq := dbutl.PQuery(`
+		SELECT CASE WHEN EXISTS (
+			SELECT 1
+			FROM exchange_cross_rate
+		   WHERE provider = ?
+			 AND base_currency = ?
+			 AND from_currency_id = ?
+			 AND to_currency_id = ?
+			 AND exchange_date = DATE ?
+		) THEN 1 ELSE 0 END
+		FROM dual
+	`, c.Provider,
+		c.Base,
+		fromID,
+		toID,
+		date)
+
+	err = tx.QueryRow(pq.Query, pq.Args...).Scan(&found)
+	if err != nil {
+		return err
+	}
+
+	if found == 0 {
+		pq = dbutl.PQuery(`
+			INSERT INTO exchange_cross_rate (
+				provider,
+				base_currency,
+				from_currency_id,
+				to_currency_id,
+				exchange_date,
+				rate
+			)
+			VALUES (?, ?, ?, ?, DATE ?, ?)
+		`, c.Provider,
+			c.Base,
+			fromID,
+			toID,
+			date,
+			ratesStore.Text(c.Value))
+	} else {
+		pq = dbutl.PQuery(`
+			UPDATE exchange_cross_rate
+			   SET rate = ?
+			 WHERE provider = ?
+			   AND base_currency = ?
+			   AND from_currency_id = ?
+			   AND to_currency_id = ?
+			   AND exchange_date = DATE ?
+		`, ratesStore.Text(c.Value),
+			c.Provider,
+			c.Base,
+			fromID,
+			toID,
+			date)
+	}
+
+	_, err = dbutl.ExecTx(tx, pq)
+	if err != nil {
+		return err
+	}
+
+	dbutl.Commit(tx)
+
+	return nil
+}
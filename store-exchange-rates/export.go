@@ -0,0 +1,458 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"store-exchange-rates/rates"
+)
+
+// The export writes the stored rates of the provider as a table with a row
+// per fixing date and a column per currency, to CSV, JSON or XLSX. The
+// optional aggregates have a row per month: the average of the fixings of
+// the month, and the rate of its last fixing. Rates carried forward over
+// gaps (check -fill) are exported daily, listed in the "carried" column of
+// their date, but left out of the aggregates, and only the months wholly
+// within the export are aggregated. They are more
+// sheets of the XLSX file, more keys of the JSON one and more files next to
+// the CSV one (rates-monthly-average.csv, rates-month-end.csv).
+
+// exportTable - rates by row (date or month) and currency
+type exportTable struct {
+	Name string
+	// first column: "date" or "month"
+	Key        string
+	Currencies []string
+	Rows       []exportRow
+	// the rows list their carried rates, in a last "carried" column
+	WithCarried bool
+}
+
+// exportRow - the rates of the date or month, nil if there is none
+type exportRow struct {
+	Key   string
+	Date  time.Time
+	Rates []*big.Rat
+	// the rate was carried forward from a previous fixing
+	Carried []bool
+}
+
+// exportFile - the tables, as written in JSON
+type exportFile struct {
+	Provider       string              `json:"provider"`
+	BaseCurrency   string              `json:"base_currency"`
+	From           string              `json:"from"`
+	To             string              `json:"to"`
+	Currencies     []string            `json:"currencies"`
+	Rates          []map[string]string `json:"rates"`
+	MonthlyAverage []map[string]string `json:"monthly_average,omitempty"`
+	MonthEnd       []map[string]string `json:"month_end,omitempty"`
+}
+
+// exportFormat - csv, json or xlsx, from the extension of the file if empty
+func exportFormat(file string, format string) (string, error) {
+	if len(format) == 0 {
+		format = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+
+	format = strings.ToLower(format)
+
+	switch format {
+	case "csv", "json", "xlsx":
+		return format, nil
+	}
+
+	return "", fmt.Errorf("unknown export format: %s (csv, json or xlsx)", format)
+}
+
+// exportCommand - write the rates of the currencies (all if empty) from
+// date (default the first day of the month of until) until until (default
+// today) to the file, with the monthly averages and end of month rates
+func exportCommand(file string, format string, date string, until string, currencyList string, monthlyAvg bool, monthEnd bool) error {
+	format, err := exportFormat(file, format)
+	if err != nil {
+		return err
+	}
+
+	to, err := parseDate(until)
+	if err != nil {
+		return err
+	}
+	to = truncateDay(to)
+
+	from := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if len(strings.TrimSpace(date)) > 0 {
+		if from, err = parseDate(date); err != nil {
+			return err
+		}
+		from = truncateDay(from)
+	}
+
+	if from.After(to) {
+		return fmt.Errorf("the export starts (%s) after it ends (%s)", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+
+	calendar, err := newCalendar()
+	if err != nil {
+		return err
+	}
+
+	stored, err := getStoredRates(from, to)
+	if err != nil {
+		return err
+	}
+
+	currencies := exportCurrencies(stored, from, currencyList)
+	if len(currencies) == 0 {
+		return fmt.Errorf("no rates of %s between %s and %s", provider.Name, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+
+	tables := []*exportTable{pivotRates(stored, from, currencies)}
+
+	if monthlyAvg {
+		tables = append(tables, monthlyRates(tables[0], calendar, from, to, "monthly average", averageRate))
+	}
+
+	if monthEnd {
+		tables = append(tables, monthlyRates(tables[0], calendar, from, to, "month end", lastRate))
+	}
+
+	switch format {
+	case "csv":
+		err = writeCSVTables(file, tables)
+	case "json":
+		err = writeJSONTables(file, from, to, tables)
+	default:
+		err = writeXLSXTables(file, tables)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	audit.Log(nil,
+		"export exchange rates",
+		"Export done.",
+		"provider", provider.Name,
+		"file", file,
+		"from", from.Format("2006-01-02"),
+		"to", to.Format("2006-01-02"),
+		"currencies", strings.Join(currencies, ","),
+		"dates", len(tables[0].Rows))
+
+	fmt.Printf("%d dates x %d currencies exported to %s\n", len(tables[0].Rows), len(currencies), file)
+
+	return nil
+}
+
+// exportCurrencies - the listed currencies, or the ones with rates from
+// the date, in order
+func exportCurrencies(stored []rates.Fixing, from time.Time, currencyList string) []string {
+	var currencies []string
+	seen := make(map[string]bool)
+
+	for _, c := range strings.Split(currencyList, ",") {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if len(c) > 0 && !seen[c] {
+			seen[c] = true
+			currencies = append(currencies, c)
+		}
+	}
+
+	if len(currencies) > 0 {
+		return currencies
+	}
+
+	for _, r := range stored {
+		if !r.Date.Before(from) && !seen[r.Currency] {
+			seen[r.Currency] = true
+			currencies = append(currencies, r.Currency)
+		}
+	}
+
+	return currencies
+}
+
+// pivotRates - a row per fixing date from the date
+func pivotRates(stored []rates.Fixing, from time.Time, currencies []string) *exportTable {
+	table := &exportTable{Name: "rates", Key: "date", Currencies: currencies, WithCarried: true}
+
+	column := make(map[string]int)
+	for i, c := range currencies {
+		column[c] = i
+	}
+
+	byDate := make(map[time.Time]*exportRow)
+	var dates []time.Time
+
+	for _, r := range stored {
+		i, ok := column[r.Currency]
+		if !ok || r.Date.Before(from) {
+			continue
+		}
+
+		rate, ok := new(big.Rat).SetString(r.Rate)
+		if !ok {
+			continue
+		}
+
+		row := byDate[r.Date]
+		if row == nil {
+			row = &exportRow{
+				Key:     r.Date.Format("2006-01-02"),
+				Date:    r.Date,
+				Rates:   make([]*big.Rat, len(currencies)),
+				Carried: make([]bool, len(currencies)),
+			}
+
+			byDate[r.Date] = row
+			dates = append(dates, r.Date)
+		}
+
+		row.Rates[i] = rate
+		row.Carried[i] = r.Carried
+	}
+
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	for _, dt := range dates {
+		table.Rows = append(table.Rows, *byDate[dt])
+	}
+
+	return table
+}
+
+// monthlyRates - a row per month of the rates from from to to, aggregated by
+// fn over the fixings; the carried rates and the months cut by the export
+// are left out
+func monthlyRates(daily *exportTable, calendar *rates.Calendar, from time.Time, to time.Time, name string, fn func(rates []*big.Rat) *big.Rat) *exportTable {
+	table := &exportTable{Name: name, Key: "month", Currencies: daily.Currencies}
+
+	for i := 0; i < len(daily.Rows); {
+		month := daily.Rows[i].Date.Format("2006-01")
+
+		j := i
+		for j < len(daily.Rows) && daily.Rows[j].Date.Format("2006-01") == month {
+			j++
+		}
+
+		if !wholeMonth(daily.Rows[i].Date, calendar, from, to) {
+			i = j
+			continue
+		}
+
+		row := exportRow{
+			Key:   month,
+			Date:  time.Date(daily.Rows[i].Date.Year(), daily.Rows[i].Date.Month(), 1, 0, 0, 0, 0, time.UTC),
+			Rates: make([]*big.Rat, len(daily.Currencies)),
+		}
+
+		for c := range daily.Currencies {
+			var values []*big.Rat
+
+			for _, r := range daily.Rows[i:j] {
+				if r.Rates[c] != nil && !r.Carried[c] {
+					values = append(values, r.Rates[c])
+				}
+			}
+
+			if len(values) > 0 {
+				row.Rates[c] = fn(values)
+			}
+		}
+
+		table.Rows = append(table.Rows, row)
+		i = j
+	}
+
+	return table
+}
+
+// wholeMonth - no business day of the month of the date is before from or
+// after to
+func wholeMonth(date time.Time, calendar *rates.Calendar, from time.Time, to time.Time) bool {
+	first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	for dt := first; dt.Month() == first.Month(); dt = dt.AddDate(0, 0, 1) {
+		if (dt.Before(from) || dt.After(to)) && calendar.IsBusinessDay(dt) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// averageRate - the average of the fixings, rounded as the stored rates
+func averageRate(values []*big.Rat) *big.Rat {
+	sum := new(big.Rat)
+	for _, v := range values {
+		sum.Add(sum, v)
+	}
+
+	return rates.Round(sum.Quo(sum, big.NewRat(int64(len(values)), 1)), rates.RateDecimals)
+}
+
+// lastRate - the last fixing of the month
+func lastRate(values []*big.Rat) *big.Rat {
+	return values[len(values)-1]
+}
+
+// carriedCurrencies - the currencies of the row carried forward, "USD,GBP"
+func (t *exportTable) carriedCurrencies(row *exportRow) string {
+	var carried []string
+
+	for i, c := range row.Carried {
+		if c && row.Rates[i] != nil {
+			carried = append(carried, t.Currencies[i])
+		}
+	}
+
+	return strings.Join(carried, ",")
+}
+
+// header - the columns of the table
+func (t *exportTable) header() []string {
+	header := append([]string{t.Key}, t.Currencies...)
+	if t.WithCarried {
+		header = append(header, "carried")
+	}
+
+	return header
+}
+
+func formatRate(rate *big.Rat) string {
+	if rate == nil {
+		return ""
+	}
+
+	return rates.FormatRate(rate)
+}
+
+// tableFile - file of the aggregate table, next to the main one
+func tableFile(file string, t *exportTable) string {
+	ext := filepath.Ext(file)
+
+	return strings.TrimSuffix(file, ext) + "-" + strings.Replace(t.Name, " ", "-", -1) + ext
+}
+
+func writeCSVTables(file string, tables []*exportTable) error {
+	for i, t := range tables {
+		name := file
+		if i > 0 {
+			name = tableFile(file, t)
+		}
+
+		if err := writeCSVTable(name, t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeCSVTable(file string, t *exportTable) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+
+	if err = w.Write(t.header()); err != nil {
+		return err
+	}
+
+	for _, row := range t.Rows {
+		record := []string{row.Key}
+		for _, rate := range row.Rates {
+			record = append(record, formatRate(rate))
+		}
+
+		if t.WithCarried {
+			record = append(record, t.carriedCurrencies(&row))
+		}
+
+		if err = w.Write(record); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// jsonRows - the rows as objects, the rates as strings to keep their
+// precision (the missing ones are left out), with the carried currencies
+// if any
+func jsonRows(t *exportTable) []map[string]string {
+	rows := []map[string]string{}
+
+	for _, row := range t.Rows {
+		obj := map[string]string{t.Key: row.Key}
+
+		for i, rate := range row.Rates {
+			if rate != nil {
+				obj[t.Currencies[i]] = formatRate(rate)
+			}
+		}
+
+		if t.WithCarried {
+			if carried := t.carriedCurrencies(&row); len(carried) > 0 {
+				obj["carried"] = carried
+			}
+		}
+
+		rows = append(rows, obj)
+	}
+
+	return rows
+}
+
+func writeJSONTables(file string, from time.Time, to time.Time, tables []*exportTable) error {
+	out := exportFile{
+		Provider:     provider.Name,
+		BaseCurrency: provider.BaseCurrency,
+		From:         from.Format("2006-01-02"),
+		To:           to.Format("2006-01-02"),
+		Currencies:   tables[0].Currencies,
+		Rates:        jsonRows(tables[0]),
+	}
+
+	for _, t := range tables[1:] {
+		switch t.Name {
+		case "monthly average":
+			out.MonthlyAverage = jsonRows(t)
+		case "month end":
+			out.MonthEnd = jsonRows(t)
+		}
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+
+	if err = enc.Encode(out); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
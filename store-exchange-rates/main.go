@@ -2,7 +2,6 @@ package main
 
 import (
 	"database/sql"
-	"encoding/xml"
 	"flag"
 	"fmt"
 	"io"
@@ -17,6 +16,8 @@ import (
 	"github.com/geo-stanciu/go-utils/utils"
 	"github.com/sirupsen/logrus"
 
+	"store-exchange-rates/rates"
+
 	_ "github.com/denisenkom/go-mssqldb"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
@@ -35,6 +36,7 @@ var (
 	config           = configuration{}
 	currentDir       string
 	lastExchangeRate time.Time
+	provider         *configuredProvider
 )
 
 func init() {
@@ -46,19 +48,6 @@ func init() {
 	currentDir = filepath.Dir(os.Args[0])
 }
 
-// Rate - Exchange rate struct
-type Rate struct {
-	Currency   string `xml:"currency,attr"`
-	Multiplier string `xml:"multiplier,attr"`
-	Rate       string `xml:",chardata"`
-}
-
-// Cube - colection of exchange rates
-type Cube struct {
-	Date string `xml:"date,attr"`
-	Rate []Rate
-}
-
 // ParseSourceStream - Parse Source Stream
 type ParseSourceStream func(source io.Reader) error
 
@@ -67,6 +56,28 @@ func main() {
 	var wg sync.WaitGroup
 
 	cfgPtr := flag.String("c", fmt.Sprintf("%s/conf.json", currentDir), "config file")
+	backfillPtr := flag.String("backfill", "", "import the BNR yearly archives of a year range, ex: 2005-2021")
+	fromFilePtr := flag.String("from-file", "", "import a local file instead of the url ({year} in the name with -backfill)")
+	ratePtr := flag.String("rate", "", "print the rate of the currency on -date")
+	convertPtr := flag.String("convert", "", "convert the amount from -from to -to on -date")
+	fromPtr := flag.String("from", "EUR", "currency converted by -convert")
+	toPtr := flag.String("to", "", "currency -convert converts to (default the base currency of the provider)")
+	datePtr := flag.String("date", "", "date of -rate and -convert, ex: 2021-05-03 (default today), first day of -check and -export")
+	servePtr := flag.String("serve", "", "serve the rates over HTTP on the address, ex: :8080")
+	crossPtr := flag.String("cross", "", "print the cross rates of the pairs on -date, ex: EUR/USD,USD/CHF")
+	untilPtr := flag.String("until", "", "with -cross, the cross rates of every fixing from -date until this date; last day of -check and -export")
+	storeCrossPtr := flag.Bool("store-cross", false, "with -cross, store the cross rates in exchange_cross_rate")
+	checkPtr := flag.Bool("check", false, "report the business days without a fixing, per currency")
+	fillPtr := flag.Bool("fill", false, "with -check, carry the previous rates forward on the missing days")
+	exportPtr := flag.String("export", "", "export the rates from -date (default the first day of the month) until -until to the file, ex: rates.xlsx")
+	formatPtr := flag.String("format", "", "format of -export: csv, json or xlsx (default from the extension of the file)")
+	currenciesPtr := flag.String("currencies", "", "currencies exported by -export, ex: EUR,USD,CHF (default all)")
+	monthlyAvgPtr := flag.Bool("monthly-avg", false, "with -export, add the monthly averages of the rates")
+	monthEndPtr := flag.Bool("month-end", false, "with -export, add the rates of the last fixing of each month")
+	reconcilePtr := flag.Bool("reconcile", false, "compare the rates of the source with the stored ones and record the differences")
+	applyPtr := flag.Bool("apply", false, "with -reconcile, also correct the stored rates")
+	validatePtr := flag.String("validate", "", "check the cross rates against the rates published by this provider, ex: ECB")
+	providerPtr := flag.String("provider", "", "provider of the rates: BNR, ECB or one from Providers (default Provider from the config)")
 
 	flag.Parse()
 
@@ -81,6 +92,16 @@ func main() {
 		return
 	}
 
+	if len(*providerPtr) == 0 {
+		*providerPtr = config.Provider
+	}
+
+	provider, err = getProvider(*providerPtr)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
 	err = dbutl.Connect2Database(&db, config.DbType, config.DbURL)
 	if err != nil {
 		log.Println(err)
@@ -95,6 +116,46 @@ func main() {
 	mw := io.MultiWriter(os.Stdout, audit)
 	log.Out = mw
 
+	ratesStore, err = newRatesStore(provider)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if len(*validatePtr) == 0 {
+		*validatePtr = config.CrossValidateWith
+	}
+
+	crossValidator, err = getCrossValidator(*validatePtr)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// queries of the stored rates, nothing is imported
+	if len(*ratePtr) > 0 || len(*convertPtr) > 0 || len(*crossPtr) > 0 || len(*servePtr) > 0 || *checkPtr || len(*exportPtr) > 0 {
+		if len(*ratePtr) > 0 {
+			err = rateCommand(ratesStore, *ratePtr, *datePtr)
+		} else if len(*convertPtr) > 0 {
+			err = convertCommand(ratesStore, *convertPtr, *fromPtr, *toPtr, *datePtr)
+		} else if len(*crossPtr) > 0 {
+			err = crossCommand(*crossPtr, *datePtr, *untilPtr, *storeCrossPtr)
+		} else if *checkPtr {
+			err = checkCommand(*datePtr, *untilPtr, *fillPtr)
+		} else if len(*exportPtr) > 0 {
+			err = exportCommand(*exportPtr, *formatPtr, *datePtr, *untilPtr, *currenciesPtr, *monthlyAvgPtr, *monthEndPtr)
+		} else {
+			err = serveRates(ratesStore, *servePtr)
+		}
+
+		if err != nil {
+			log.Println(err)
+		}
+
+		wg.Wait()
+		return
+	}
+
 	err = prepareCurrencies()
 	if err != nil {
 		log.Println(err)
@@ -107,21 +168,51 @@ func main() {
 		return
 	}
 
-	err = getStreamFromURL(config.RatesXMLUrl, parseXMLSource)
+	if *reconcilePtr {
+		reconciling.Enabled = true
+		reconciling.Apply = *applyPtr
+
+		// every date of the source is compared
+		lastExchangeRate = time.Time{}
+	}
+
+	if len(*backfillPtr) > 0 {
+		err = backfill(*backfillPtr, *fromFilePtr)
+	} else if len(*fromFilePtr) > 0 {
+		err = getStreamFromFile(*fromFilePtr, parseSource)
+	} else {
+		err = getStreamFromURL(provider.URL, parseSource)
+	}
+
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	audit.Log(nil, "import exchange rates", "Import done.")
+	if reconciling.Enabled {
+		audit.Log(nil,
+			"reconcile exchange rates",
+			"Reconcile done.",
+			"provider", provider.Name,
+			"checked", reconciling.Checked,
+			"differences", reconciling.Differences,
+			"applied", reconciling.Applied)
+	} else {
+		audit.Log(nil, "import exchange rates", "Import done.", "provider", provider.Name)
+	}
 	wg.Wait()
 }
 
 func getLastExchangeRate() (time.Time, error) {
 	var lastExchangeRate time.Time
 	pq := dbutl.PQuery(`
-		select coalesce(max(exchange_date), date '1970-01-01') as exchange_date from exchange_rate
-	`)
+		select coalesce(max(exchange_date), date '1970-01-01') as exchange_date
+		  from exchange_rate
+		 where provider = ?
+		   and base_currency = ?
+		   and carried = 0
+	`, provider.Name,
+		provider.BaseCurrency)
 
 	err := db.QueryRow(pq.Query, pq.Args...).Scan(&lastExchangeRate)
 	if err != nil {
@@ -138,6 +229,10 @@ func getStreamFromURL(url string, callback ParseSourceStream) error {
 	}
 	defer response.Body.Close()
 
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, response.Status)
+	}
+
 	err = callback(response.Body)
 	if err != nil {
 		return err
@@ -161,36 +256,9 @@ func getStreamFromFile(filename string, callback ParseSourceStream) error {
 	return nil
 }
 
-func parseXMLSource(source io.Reader) error {
-	decoder := xml.NewDecoder(source)
-
-	for {
-		t, err := decoder.Token()
-		if t == nil {
-			break
-		}
-		if err != nil && err != io.EOF {
-			return err
-		}
-
-		switch se := t.(type) {
-		case xml.StartElement:
-			if se.Name.Local == "Cube" {
-				var cube Cube
-				decoder.DecodeElement(&cube, &se)
-
-				if isBeforeTheLastImport(cube.Date) {
-					continue
-				}
-
-				if err := dealWithRates(&cube); err != nil {
-					return err
-				}
-			}
-		}
-	}
-
-	return nil
+// parseSource - store the fixings read by the provider
+func parseSource(source io.Reader) error {
+	return provider.Parse(source, dealWithRates)
 }
 
 func isBeforeTheLastImport(date string) bool {
@@ -207,7 +275,11 @@ func isBeforeTheLastImport(date string) bool {
 	return false
 }
 
-func dealWithRates(cube *Cube) error {
+func dealWithRates(f *fixing) error {
+	if isBeforeTheLastImport(f.Date) {
+		return nil
+	}
+
 	tx, err := dbutl.BeginTransaction()
 	if err != nil {
 		return err
@@ -219,13 +291,18 @@ func dealWithRates(cube *Cube) error {
 		return err
 	}
 
-	if err = storeRates(tx, *cube); err != nil {
+	if err = storeRates(tx, f); err != nil {
 		return err
 	}
 
 	dbutl.Commit(tx)
 
-	return nil
+	// the stored rates did not change
+	if reconciling.Enabled && !reconciling.Apply {
+		return nil
+	}
+
+	return materializeCrossRates(f.Date)
 }
 
 func getCurrencyIfExists(tx *sql.Tx, currency string) (int32, error) {
@@ -291,7 +368,12 @@ func prepareCurrencies() error {
 		return err
 	}
 
-	err = storeRate(tx, "1970-01-01", "RON", 1.0, 1.0)
+	_, err = addCurrencyIfNotExists(tx, provider.BaseCurrency)
+	if err != nil {
+		return err
+	}
+
+	err = storeRate(tx, "1970-01-01", provider.BaseCurrency, 1.0, 1.0)
 	if err != nil {
 		return err
 	}
@@ -301,55 +383,40 @@ func prepareCurrencies() error {
 	return nil
 }
 
-func storeRates(tx *sql.Tx, cube Cube) error {
-	var err error
-
-	audit.Log(nil, "exchange rates", "Importing exchange rates...", "date", cube.Date)
+func storeRates(tx *sql.Tx, f *fixing) error {
+	audit.Log(nil, "exchange rates", "Importing exchange rates...", "provider", provider.Name, "date", f.Date)
 
-	for _, rate := range cube.Rate {
-		multiplier := 1.0
-		exchRate := 1.0
+	added := imported.Rates
 
-		if rate.Multiplier == "-" {
-			multiplier = 1.0
-		} else if len(rate.Multiplier) > 0 {
-			multiplier, err = strconv.ParseFloat(rate.Multiplier, 64)
-			if err != nil {
-				return err
-			}
-		}
-
-		if rate.Rate == "-" {
+	for _, r := range f.Rates {
+		multiplier, exchRate, ok, err := provider.rate(r)
+		if err != nil {
+			return err
+		} else if !ok {
 			continue
-		} else {
-			exchRate, err = strconv.ParseFloat(rate.Rate, 64)
-			if err != nil {
-				return err
-			}
 		}
 
-		err = storeRate(tx, cube.Date, rate.Currency, multiplier, exchRate)
+		err = storeRate(tx, f.Date, r.Currency, multiplier, exchRate)
 		if err != nil {
 			return err
 		}
 	}
 
+	if imported.Rates > added {
+		imported.Dates++
+	}
+
 	return nil
 }
 
 func storeRate(tx *sql.Tx, date string, currency string, multiplier float64, exchRate float64) error {
-	found := 0
+	carried := 0
 	var currencyID int32
 	var err error
 
 	exch := big.NewFloat(exchRate)
 	mul := big.NewFloat(multiplier)
-	srate := new(big.Float).SetMode(big.ToNearestAway).Quo(exch, mul).Text('f', 6)
-
-	rate, err := strconv.ParseFloat(srate, 64)
-	if err != nil {
-		return err
-	}
+	srate := new(big.Float).SetMode(big.ToNearestAway).Quo(exch, mul).Text('f', rates.RateDecimals)
 
 	if config.AddMissingCurrencies {
 		currencyID, err = addCurrencyIfNotExists(tx, currency)
@@ -361,46 +428,100 @@ func storeRate(tx *sql.Tx, date string, currency string, multiplier float64, exc
 		return err
 	}
 
+	if reconciling.Enabled {
+		return reconcileRate(tx, date, currency, currencyID, srate)
+	}
+
 	pq := dbutl.PQuery(`
-		SELECT CASE WHEN EXISTS (
-			SELECT 1
-			FROM exchange_rate
-		   WHERE currency_id = ?
-			 AND exchange_date = DATE ?
-		) THEN 1 ELSE 0 END
-		FROM dual
-	`, currencyID,
+		SELECT carried
+		  FROM exchange_rate
+		 WHERE provider = ?
+		   AND base_currency = ?
+		   AND currency_id = ?
+		   AND exchange_date = DATE ?
+	`, provider.Name,
+		provider.BaseCurrency,
+		currencyID,
 		date)
 
-	err = tx.QueryRow(pq.Query, pq.Args...).Scan(&found)
-	if err != nil {
-		return err
-	}
+	err = tx.QueryRow(pq.Query, pq.Args...).Scan(&carried)
+	if err == sql.ErrNoRows {
+		err = insertRate(tx, currencyID, date, srate)
+		if err != nil {
+			return err
+		}
 
-	if found == 0 {
+		audit.Log(nil,
+			"add exchange rate",
+			"added value",
+			"provider", provider.Name,
+			"date", date,
+			"currency", currency,
+			"rate", srate)
+	} else if err != nil {
+		return err
+	} else if carried == 1 {
+		// the fixing of a day filled by -check -fill
 		pq = dbutl.PQuery(`
-			INSERT INTO exchange_rate (
-				currency_id,
-				exchange_date,
-				rate
-			)
-			VALUES (?, DATE ?, ?)
-		`, currencyID,
-			date,
-			rate)
+			UPDATE exchange_rate
+			   SET rate = ?,
+			       carried = 0
+			 WHERE provider = ?
+			   AND base_currency = ?
+			   AND currency_id = ?
+			   AND exchange_date = DATE ?
+		`, srate,
+			provider.Name,
+			provider.BaseCurrency,
+			currencyID,
+			date)
 
 		_, err = dbutl.ExecTx(tx, pq)
 		if err != nil {
 			return err
 		}
 
+		imported.Rates++
+
 		audit.Log(nil,
 			"add exchange rate",
-			"added value",
+			"replaced carried value",
+			"provider", provider.Name,
 			"date", date,
 			"currency", currency,
-			"rate", rate)
+			"rate", srate)
 	}
 
 	return nil
 }
+
+func insertRate(tx *sql.Tx, currencyID int32, date string, srate string) error {
+	rate, err := strconv.ParseFloat(srate, 64)
+	if err != nil {
+		return err
+	}
+
+	pq := dbutl.PQuery(`
+		INSERT INTO exchange_rate (
+			provider,
+			base_currency,
+			currency_id,
+			exchange_date,
+			rate
+		)
+		VALUES (?, ?, ?, DATE ?, ?)
+	`, provider.Name,
+		provider.BaseCurrency,
+		currencyID,
+		date,
+		rate)
+
+	_, err = dbutl.ExecTx(tx, pq)
+	if err != nil {
+		return err
+	}
+
+	imported.Rates++
+
+	return nil
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The rates are stored as the value, in the base currency of their
+// provider, of one unit of each currency. Each rate keeps the provider and
+// the base currency it came from, so the fixings of several providers
+// are held side by side.
+
+const (
+	defaultProvider = "BNR"
+	defaultECBUrl   = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+)
+
+// providerConfig - where and how the rates of a provider are read
+type providerConfig struct {
+	Name         string `json:"Name"`
+	Type         string `json:"Type"`
+	URL          string `json:"URL"`
+	YearURL      string `json:"YearURL"`
+	BaseCurrency string `json:"BaseCurrency"`
+	// the quotes are units of the currency for one unit of the base
+	// currency (as ECB publishes them) and are stored inverted
+	Inverse bool `json:"Inverse"`
+	// csv and json mapping
+	Delimiter       string `json:"Delimiter"`
+	ItemsPath       string `json:"ItemsPath"`
+	DateField       string `json:"DateField"`
+	DateFormat      string `json:"DateFormat"`
+	CurrencyField   string `json:"CurrencyField"`
+	RateField       string `json:"RateField"`
+	MultiplierField string `json:"MultiplierField"`
+}
+
+// providerRate - rate as quoted by the provider
+type providerRate struct {
+	Currency   string
+	Multiplier string
+	Rate       string
+}
+
+// fixing - the rates of one date
+type fixing struct {
+	Date  string
+	Rates []providerRate
+}
+
+// Provider - reads the fixings published by a source of exchange rates
+type Provider interface {
+	Parse(source io.Reader, fn func(f *fixing) error) error
+}
+
+type configuredProvider struct {
+	providerConfig
+	Provider
+}
+
+var builtinProviders = []providerConfig{
+	{Name: "BNR", Type: "bnr", BaseCurrency: "RON"},
+	{Name: "ECB", Type: "ecb", URL: defaultECBUrl, BaseCurrency: "EUR", Inverse: true},
+}
+
+// getProvider - the configured provider with the name, else the builtin one
+func getProvider(name string) (*configuredProvider, error) {
+	if len(name) == 0 {
+		name = defaultProvider
+	}
+
+	var cfg *providerConfig
+
+	for i := range config.Providers {
+		if strings.EqualFold(config.Providers[i].Name, name) {
+			cfg = &config.Providers[i]
+			break
+		}
+	}
+
+	if cfg == nil {
+		for i := range builtinProviders {
+			if strings.EqualFold(builtinProviders[i].Name, name) {
+				c := builtinProviders[i]
+				cfg = &c
+				break
+			}
+		}
+	}
+
+	if cfg == nil {
+		return nil, fmt.Errorf("unknown provider: %s", name)
+	}
+
+	if strings.EqualFold(cfg.Type, "bnr") {
+		if len(cfg.URL) == 0 {
+			cfg.URL = config.RatesXMLUrl
+		}
+
+		if len(cfg.YearURL) == 0 {
+			cfg.YearURL = config.RatesYearXMLUrl
+		}
+
+		if len(cfg.YearURL) == 0 {
+			cfg.YearURL = defaultRatesYearXMLUrl
+		}
+	}
+
+	if len(cfg.BaseCurrency) == 0 {
+		return nil, fmt.Errorf("provider %s: no BaseCurrency", cfg.Name)
+	}
+
+	cfg.Name = strings.ToUpper(cfg.Name)
+	cfg.BaseCurrency = strings.ToUpper(cfg.BaseCurrency)
+
+	var p Provider
+
+	switch strings.ToLower(cfg.Type) {
+	case "bnr":
+		p = &bnrProvider{}
+	case "ecb":
+		p = &ecbProvider{}
+	case "csv":
+		p = &csvProvider{cfg: cfg}
+	case "json":
+		p = &jsonProvider{cfg: cfg}
+	default:
+		return nil, fmt.Errorf("provider %s: unknown type %s", cfg.Name, cfg.Type)
+	}
+
+	return &configuredProvider{providerConfig: *cfg, Provider: p}, nil
+}
+
+// rate - the quote as stored: a multiplier and a rate
+func (p *configuredProvider) rate(r providerRate) (float64, float64, bool, error) {
+	var err error
+
+	multiplier := 1.0
+	exchRate := 1.0
+
+	if r.Multiplier == "-" {
+		multiplier = 1.0
+	} else if len(r.Multiplier) > 0 {
+		multiplier, err = strconv.ParseFloat(r.Multiplier, 64)
+		if err != nil {
+			return 0, 0, false, err
+		}
+	}
+
+	if r.Rate == "-" || len(r.Rate) == 0 {
+		return 0, 0, false, nil
+	}
+
+	exchRate, err = strconv.ParseFloat(r.Rate, 64)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	// units of the currency for multiplier units of the base currency
+	// (the inverted rate is stored with rates.RateDecimals, to keep the
+	// significant digits of the weak currencies)
+	if p.Inverse {
+		if exchRate == 0 {
+			return 0, 0, false, nil
+		}
+
+		return exchRate, multiplier, true, nil
+	}
+
+	return multiplier, exchRate, true, nil
+}
+
+// Rate - Exchange rate struct
+type Rate struct {
+	Currency   string `xml:"currency,attr"`
+	Multiplier string `xml:"multiplier,attr"`
+	Rate       string `xml:",chardata"`
+}
+
+// Cube - colection of exchange rates
+type Cube struct {
+	Date string `xml:"date,attr"`
+	Rate []Rate
+}
+
+// bnrProvider - nbrfxrates.xml of the National Bank of Romania
+type bnrProvider struct{}
+
+// Parse - Provider
+func (p *bnrProvider) Parse(source io.Reader, fn func(f *fixing) error) error {
+	decoder := xml.NewDecoder(source)
+
+	for {
+		t, err := decoder.Token()
+		if t == nil {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		switch se := t.(type) {
+		case xml.StartElement:
+			if se.Name.Local == "Cube" {
+				var cube Cube
+				decoder.DecodeElement(&cube, &se)
+
+				f := fixing{Date: cube.Date}
+				for _, r := range cube.Rate {
+					f.Rates = append(f.Rates, providerRate{
+						Currency:   r.Currency,
+						Multiplier: r.Multiplier,
+						Rate:       strings.TrimSpace(r.Rate),
+					})
+				}
+
+				if err := fn(&f); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+type ecbRate struct {
+	Currency string `xml:"currency,attr"`
+	Rate     string `xml:"rate,attr"`
+}
+
+type ecbCube struct {
+	Time  string    `xml:"time,attr"`
+	Rates []ecbRate `xml:"Cube"`
+}
+
+// ecbProvider - eurofxref xml of the European Central Bank
+// (daily, hist-90d or hist files)
+type ecbProvider struct{}
+
+// Parse - Provider
+func (p *ecbProvider) Parse(source io.Reader, fn func(f *fixing) error) error {
+	decoder := xml.NewDecoder(source)
+
+	for {
+		t, err := decoder.Token()
+		if t == nil {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		se, ok := t.(xml.StartElement)
+		if !ok || se.Name.Local != "Cube" || !hasAttr(se, "time") {
+			continue
+		}
+
+		var cube ecbCube
+		if err := decoder.DecodeElement(&cube, &se); err != nil {
+			return err
+		}
+
+		f := fixing{Date: cube.Time}
+		for _, r := range cube.Rates {
+			f.Rates = append(f.Rates, providerRate{Currency: r.Currency, Rate: r.Rate})
+		}
+
+		if err := fn(&f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func hasAttr(se xml.StartElement, name string) bool {
+	for _, a := range se.Attr {
+		if a.Name.Local == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fixingBuilder - groups the rates read row by row by their date
+type fixingBuilder struct {
+	cfg    *providerConfig
+	dates  []string
+	byDate map[string]*fixing
+}
+
+func newFixingBuilder(cfg *providerConfig) *fixingBuilder {
+	return &fixingBuilder{cfg: cfg, byDate: make(map[string]*fixing)}
+}
+
+func (b *fixingBuilder) add(date string, r providerRate) error {
+	format := b.cfg.DateFormat
+	if len(format) == 0 {
+		format = "2006-01-02"
+	}
+
+	dt, err := time.Parse(format, strings.TrimSpace(date))
+	if err != nil {
+		return fmt.Errorf("provider %s: invalid date %s", b.cfg.Name, date)
+	}
+
+	day := dt.Format("2006-01-02")
+
+	f, ok := b.byDate[day]
+	if !ok {
+		f = &fixing{Date: day}
+		b.byDate[day] = f
+		b.dates = append(b.dates, day)
+	}
+
+	r.Currency = strings.ToUpper(strings.TrimSpace(r.Currency))
+	r.Rate = strings.TrimSpace(r.Rate)
+	r.Multiplier = strings.TrimSpace(r.Multiplier)
+	f.Rates = append(f.Rates, r)
+
+	return nil
+}
+
+func (b *fixingBuilder) each(fn func(f *fixing) error) error {
+	for _, day := range b.dates {
+		if err := fn(b.byDate[day]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func fieldOrDefault(value string, def string) string {
+	if len(value) > 0 {
+		return value
+	}
+
+	return def
+}
+
+// csvProvider - csv file with a header, one rate per row
+type csvProvider struct {
+	cfg *providerConfig
+}
+
+// Parse - Provider
+func (p *csvProvider) Parse(source io.Reader, fn func(f *fixing) error) error {
+	r := csv.NewReader(source)
+	r.TrimLeadingSpace = true
+
+	if len(p.cfg.Delimiter) > 0 {
+		r.Comma = []rune(p.cfg.Delimiter)[0]
+	}
+
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	column := func(name string, required bool) (int, error) {
+		i, ok := columns[strings.ToLower(name)]
+		if !ok && required {
+			return -1, fmt.Errorf("provider %s: no column %s", p.cfg.Name, name)
+		} else if !ok {
+			return -1, nil
+		}
+
+		return i, nil
+	}
+
+	dateCol, err := column(fieldOrDefault(p.cfg.DateField, "date"), true)
+	if err != nil {
+		return err
+	}
+
+	currencyCol, err := column(fieldOrDefault(p.cfg.CurrencyField, "currency"), true)
+	if err != nil {
+		return err
+	}
+
+	rateCol, err := column(fieldOrDefault(p.cfg.RateField, "rate"), true)
+	if err != nil {
+		return err
+	}
+
+	multiplierCol, err := column(fieldOrDefault(p.cfg.MultiplierField, "multiplier"), false)
+	if err != nil {
+		return err
+	}
+
+	b := newFixingBuilder(p.cfg)
+
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		rate := providerRate{Currency: row[currencyCol], Rate: row[rateCol]}
+		if multiplierCol >= 0 {
+			rate.Multiplier = row[multiplierCol]
+		}
+
+		if err = b.add(row[dateCol], rate); err != nil {
+			return err
+		}
+	}
+
+	return b.each(fn)
+}
+
+// jsonProvider - json array of rates, at ItemsPath (ex: data.rates)
+type jsonProvider struct {
+	cfg *providerConfig
+}
+
+// Parse - Provider
+func (p *jsonProvider) Parse(source io.Reader, fn func(f *fixing) error) error {
+	decoder := json.NewDecoder(source)
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return err
+	}
+
+	if len(p.cfg.ItemsPath) > 0 {
+		for _, key := range strings.Split(p.cfg.ItemsPath, ".") {
+			obj, ok := doc.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("provider %s: %s not found", p.cfg.Name, p.cfg.ItemsPath)
+			}
+
+			doc = obj[key]
+		}
+	}
+
+	items, ok := doc.([]interface{})
+	if !ok {
+		return fmt.Errorf("provider %s: %s is not an array", p.cfg.Name, fieldOrDefault(p.cfg.ItemsPath, "the document"))
+	}
+
+	value := func(item map[string]interface{}, name string) string {
+		v, ok := item[name]
+		if !ok || v == nil {
+			return ""
+		}
+
+		return fmt.Sprint(v)
+	}
+
+	b := newFixingBuilder(p.cfg)
+
+	for _, elem := range items {
+		item, ok := elem.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		rate := providerRate{
+			Currency:   value(item, fieldOrDefault(p.cfg.CurrencyField, "currency")),
+			Rate:       value(item, fieldOrDefault(p.cfg.RateField, "rate")),
+			Multiplier: value(item, fieldOrDefault(p.cfg.MultiplierField, "multiplier")),
+		}
+
+		if err := b.add(value(item, fieldOrDefault(p.cfg.DateField, "date")), rate); err != nil {
+			return err
+		}
+	}
+
+	return b.each(fn)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"store-exchange-rates/rates"
+)
+
+// rateAnswer - rate as returned by -rate and /rate
+// (the numbers are strings, to keep their precision)
+type rateAnswer struct {
+	Currency   string `json:"currency"`
+	Date       string `json:"date"`
+	FixingDate string `json:"fixing_date"`
+	Rate       string `json:"rate"`
+}
+
+// conversionAnswer - conversion as returned by -convert and /convert
+type conversionAnswer struct {
+	Amount string     `json:"amount"`
+	From   rateAnswer `json:"from"`
+	To     rateAnswer `json:"to"`
+	Result string     `json:"result"`
+}
+
+func newRateAnswer(r *rates.Rate) rateAnswer {
+	return rateAnswer{
+		Currency:   r.Currency,
+		Date:       r.Date.Format("2006-01-02"),
+		FixingDate: r.FixingDate.Format("2006-01-02"),
+		Rate:       rates.FormatRate(r.Value),
+	}
+}
+
+func newConversionAnswer(store *rates.Store, c *rates.Conversion) conversionAnswer {
+	return conversionAnswer{
+		Amount: c.Amount.FloatString(rates.Decimals),
+		From:   newRateAnswer(c.From),
+		To:     newRateAnswer(c.To),
+		Result: store.Text(c.Result),
+	}
+}
+
+// parseDate - 2006-01-02, today if empty
+func parseDate(value string) (time.Time, error) {
+	if len(strings.TrimSpace(value)) == 0 {
+		return time.Now(), nil
+	}
+
+	return time.Parse("2006-01-02", strings.TrimSpace(value))
+}
+
+func rateCommand(store *rates.Store, currency string, date string) error {
+	dt, err := parseDate(date)
+	if err != nil {
+		return err
+	}
+
+	rate, err := store.RateAt(currency, dt)
+	if err != nil {
+		return err
+	}
+
+	a := newRateAnswer(rate)
+	fmt.Printf("%s %s: %s %s (%s fixing of %s)\n", a.Currency, a.Date, a.Rate, store.Base, store.Provider, a.FixingDate)
+
+	return nil
+}
+
+func convertCommand(store *rates.Store, amount string, from string, to string, date string) error {
+	dt, err := parseDate(date)
+	if err != nil {
+		return err
+	}
+
+	value, err := rates.ParseAmount(amount)
+	if err != nil {
+		return err
+	}
+
+	if len(to) == 0 {
+		to = store.Base
+	}
+
+	conv, err := store.Convert(value, from, to, dt)
+	if err != nil {
+		return err
+	}
+
+	a := newConversionAnswer(store, conv)
+	fmt.Printf("%s %s = %s %s (%s %s: %s = %s %s, %s = %s %s)\n",
+		a.Amount, a.From.Currency,
+		a.Result, a.To.Currency,
+		store.Provider, a.From.Date,
+		a.From.Currency, a.From.Rate, store.Base,
+		a.To.Currency, a.To.Rate, store.Base)
+
+	return nil
+}
+
+// serveRates - HTTP API:
+//
+//	GET /rate?currency=EUR&date=2021-05-03
+//	GET /convert?amount=100&from=EUR&to=USD&date=2021-05-03
+func serveRates(store *rates.Store, addr string) error {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/rate", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		dt, err := parseDate(query.Get("date"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rate, err := store.RateAt(query.Get("currency"), dt)
+		if err != nil {
+			writeQueryError(w, r.URL, err)
+			return
+		}
+
+		writeJSON(w, newRateAnswer(rate))
+	})
+
+	mux.HandleFunc("/convert", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		dt, err := parseDate(query.Get("date"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		amount, err := rates.ParseAmount(query.Get("amount"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		to := query.Get("to")
+		if len(to) == 0 {
+			to = store.Base
+		}
+
+		conv, err := store.Convert(amount, query.Get("from"), to, dt)
+		if err != nil {
+			writeQueryError(w, r.URL, err)
+			return
+		}
+
+		writeJSON(w, newConversionAnswer(store, conv))
+	})
+
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 60 * time.Second,
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	go func() {
+		<-sigs
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		srv.Shutdown(ctx)
+	}()
+
+	audit.Log(nil, "serve exchange rates", "Listening...", "addr", addr)
+
+	err := srv.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	audit.Log(nil, "serve exchange rates", "Server stopped.")
+
+	return nil
+}
+
+func writeQueryError(w http.ResponseWriter, u *url.URL, err error) {
+	if errors.Is(err, rates.ErrNoRate) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	audit.Log(err, "serve exchange rates", "query failed", "url", u.String())
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,135 @@
+package rates
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Calendar - the business days of a provider: the days without a weekend
+// or a holiday, when a fixing is expected
+type Calendar struct {
+	Name string
+	// one-off holidays, by "2006-01-02"
+	dates map[string]string
+	// holidays of every year, by "01-02"
+	yearly map[string]string
+}
+
+// calendars with the holidays of the country
+var holidayCalendars = map[string]func(year int) map[string]string{
+	"RO":   romanianHolidays,
+	"NONE": func(year int) map[string]string { return nil },
+}
+
+// NewCalendar - the named calendar (RO if empty, NONE for the weekends
+// only) with the extra holidays, ex: "2021-12-24" once or "12-24" yearly
+func NewCalendar(name string, extra []string) (*Calendar, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if len(name) == 0 {
+		name = "RO"
+	}
+
+	if _, ok := holidayCalendars[name]; !ok {
+		return nil, fmt.Errorf("unknown holiday calendar: %s", name)
+	}
+
+	c := &Calendar{
+		Name:   name,
+		dates:  make(map[string]string),
+		yearly: make(map[string]string),
+	}
+
+	for _, day := range extra {
+		day = strings.TrimSpace(day)
+
+		if _, err := time.Parse("2006-01-02", day); err == nil {
+			c.dates[day] = "holiday"
+		} else if _, err := time.Parse("01-02", day); err == nil {
+			c.yearly[day] = "holiday"
+		} else {
+			return nil, fmt.Errorf("invalid holiday: %s (ex: 2021-12-24 or 12-24)", day)
+		}
+	}
+
+	return c, nil
+}
+
+// Holiday - name of the holiday on the date (false if it is not one)
+func (c *Calendar) Holiday(date time.Time) (string, bool) {
+	if name, ok := c.dates[date.Format("2006-01-02")]; ok {
+		return name, true
+	}
+
+	if name, ok := c.yearly[date.Format("01-02")]; ok {
+		return name, true
+	}
+
+	name, ok := holidayCalendars[c.Name](date.Year())[date.Format("01-02")]
+
+	return name, ok
+}
+
+// IsBusinessDay - not a weekend day, nor a holiday
+func (c *Calendar) IsBusinessDay(date time.Time) bool {
+	if wd := date.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+
+	_, holiday := c.Holiday(date)
+
+	return !holiday
+}
+
+// OrthodoxEaster - date of the Orthodox Easter of the year (1900 - 2099),
+// computed in the Julian calendar and moved 13 days to the Gregorian one
+func OrthodoxEaster(year int) time.Time {
+	a := year % 4
+	b := year % 7
+	c := year % 19
+	d := (19*c + 15) % 30
+	e := (2*a + 4*b - d + 34) % 7
+	month := (d + e + 114) / 31
+	day := (d+e+114)%31 + 1
+
+	return time.Date(year, time.Month(month), day+13, 0, 0, 0, 0, time.UTC)
+}
+
+// romanianHolidays - the legal holidays (Codul muncii, art. 139), when
+// BNR does not publish rates, by "01-02", from the year they were set
+func romanianHolidays(year int) map[string]string {
+	days := map[string]string{
+		"01-01": "Anul Nou",
+		"01-02": "Anul Nou",
+		"05-01": "Ziua Muncii",
+		"12-01": "Ziua Nationala",
+		"12-25": "Craciunul",
+		"12-26": "Craciunul",
+	}
+
+	add := func(from int, dt time.Time, name string) {
+		if year >= from {
+			days[dt.Format("01-02")] = name
+		}
+	}
+
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	easter := OrthodoxEaster(year)
+
+	add(2024, day(time.January, 6), "Boboteaza")
+	add(2024, day(time.January, 7), "Sfantul Ioan")
+	add(2017, day(time.January, 24), "Ziua Unirii Principatelor")
+	add(2018, easter.AddDate(0, 0, -2), "Vinerea Mare")
+	add(0, easter, "Pastele")
+	add(0, easter.AddDate(0, 0, 1), "Pastele")
+	add(2017, day(time.June, 1), "Ziua Copilului")
+	add(2008, easter.AddDate(0, 0, 49), "Rusaliile")
+	add(2008, easter.AddDate(0, 0, 50), "Rusaliile")
+	add(2009, day(time.August, 15), "Adormirea Maicii Domnului")
+	add(2012, day(time.November, 30), "Sfantul Andrei")
+
+	return days
+}
@@ -0,0 +1,107 @@
+package rates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOrthodoxEaster(t *testing.T) {
+	tests := []struct {
+		year int
+		want string
+	}{
+		{2008, "2008-04-27"},
+		{2010, "2010-04-04"},
+		{2018, "2018-04-08"},
+		{2019, "2019-04-28"},
+		{2020, "2020-04-19"},
+		{2021, "2021-05-02"},
+		{2022, "2022-04-24"},
+		{2023, "2023-04-16"},
+		{2024, "2024-05-05"},
+		{2025, "2025-04-20"},
+		{2026, "2026-04-12"},
+	}
+
+	for _, tt := range tests {
+		if got := OrthodoxEaster(tt.year).Format("2006-01-02"); got != tt.want {
+			t.Errorf("OrthodoxEaster(%d) = %s, want %s", tt.year, got, tt.want)
+		}
+	}
+}
+
+func TestIsBusinessDay(t *testing.T) {
+	tests := []struct {
+		calendar string
+		extra    []string
+		date     string
+		want     bool
+	}{
+		{"RO", nil, "2024-03-01", true},
+		{"RO", nil, "2024-03-02", false},
+		{"RO", nil, "2024-03-03", false},
+		{"RO", nil, "2024-01-01", false},
+		{"RO", nil, "2024-01-02", false},
+		{"RO", nil, "2025-01-06", false},
+		{"RO", nil, "2023-01-06", true},
+		{"RO", nil, "2024-01-24", false},
+		{"RO", nil, "2014-01-24", true},
+		{"RO", nil, "2024-05-01", false},
+		// Good Friday, Easter Monday, from 2018
+		{"RO", nil, "2024-05-03", false},
+		{"RO", nil, "2024-05-06", false},
+		{"RO", nil, "2024-05-07", true},
+		{"RO", nil, "2017-04-14", true},
+		{"RO", nil, "2017-04-17", false},
+		{"RO", nil, "2024-06-03", true},
+		// Pentecost Monday
+		{"RO", nil, "2024-06-24", false},
+		{"RO", nil, "2023-06-01", false},
+		{"RO", nil, "2024-08-15", false},
+		{"RO", nil, "2023-11-30", false},
+		{"RO", nil, "2011-11-30", true},
+		{"RO", nil, "2024-12-25", false},
+		{"RO", nil, "2024-12-26", false},
+		{"RO", nil, "2024-12-27", true},
+		{"", nil, "2024-12-25", false},
+		{"NONE", nil, "2024-12-25", true},
+		{"NONE", nil, "2024-12-28", false},
+		{"RO", []string{"2024-12-24"}, "2024-12-24", false},
+		{"RO", []string{"2024-12-24"}, "2025-12-24", true},
+		{"NONE", []string{"12-31"}, "2024-12-31", false},
+		{"NONE", []string{"12-31"}, "2025-12-31", false},
+	}
+
+	for _, tt := range tests {
+		c, err := NewCalendar(tt.calendar, tt.extra)
+		if err != nil {
+			t.Fatalf("NewCalendar(%q, %v): %v", tt.calendar, tt.extra, err)
+		}
+
+		date, err := time.Parse("2006-01-02", tt.date)
+		if err != nil {
+			t.Fatalf("invalid test date %s", tt.date)
+		}
+
+		if got := c.IsBusinessDay(date); got != tt.want {
+			t.Errorf("%s %v: IsBusinessDay(%s) = %v, want %v", c.Name, tt.extra, tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestNewCalendarErrors(t *testing.T) {
+	tests := []struct {
+		calendar string
+		extra    []string
+	}{
+		{"XX", nil},
+		{"RO", []string{"24-12-2024"}},
+		{"RO", []string{"12-32"}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewCalendar(tt.calendar, tt.extra); err == nil {
+			t.Errorf("NewCalendar(%q, %v): no error", tt.calendar, tt.extra)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package rates
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// RoundingMode - how the cross rates and conversions are rounded
+type RoundingMode string
+
+// rounding modes
+const (
+	HalfAwayFromZero RoundingMode = "half-away"
+	HalfEven         RoundingMode = "half-even"
+	HalfTowardZero   RoundingMode = "half-down"
+	TowardZero       RoundingMode = "down"
+	AwayFromZero     RoundingMode = "up"
+	Floor            RoundingMode = "floor"
+	Ceiling          RoundingMode = "ceiling"
+)
+
+// MaxDecimals - precision of the exchange_cross_rate table
+const MaxDecimals = 12
+
+// ParseRoundingMode - one of the modes, half-away if empty
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	mode := RoundingMode(strings.ToLower(strings.TrimSpace(s)))
+
+	switch mode {
+	case "":
+		return HalfAwayFromZero, nil
+	case HalfAwayFromZero, HalfEven, HalfTowardZero, TowardZero, AwayFromZero, Floor, Ceiling:
+		return mode, nil
+	}
+
+	return "", fmt.Errorf("unknown rounding mode: %s", s)
+}
+
+// RoundMode - x rounded to the decimals with the mode
+func RoundMode(x *big.Rat, decimals int, mode RoundingMode) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+
+	num := new(big.Int).Mul(x.Num(), scale)
+	den := x.Denom()
+
+	// q truncated toward zero, |r| < den
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+
+	if r.Sign() != 0 {
+		sign := num.Sign()
+
+		// 2|r| compared with den: below, at or past the half
+		half := new(big.Int).Abs(r)
+		half.Lsh(half, 1)
+		cmp := half.Cmp(den)
+
+		away := false
+
+		switch mode {
+		case TowardZero:
+		case AwayFromZero:
+			away = true
+		case Floor:
+			away = sign < 0
+		case Ceiling:
+			away = sign > 0
+		case HalfTowardZero:
+			away = cmp > 0
+		case HalfEven:
+			away = cmp > 0 || (cmp == 0 && q.Bit(0) == 1)
+		default:
+			away = cmp >= 0
+		}
+
+		if away {
+			q.Add(q, big.NewInt(int64(sign)))
+		}
+	}
+
+	return new(big.Rat).SetFrac(q, scale)
+}
+
+// round - x with the precision and rounding mode of the store
+func (s *Store) round(x *big.Rat) *big.Rat {
+	return RoundMode(x, s.decimals(), s.Rounding)
+}
+
+// decimals - precision of the store
+func (s *Store) decimals() int {
+	if s.Precision < 0 || s.Precision > MaxDecimals {
+		return Decimals
+	}
+
+	return s.Precision
+}
+
+// Text - x with the precision of the store
+func (s *Store) Text(x *big.Rat) string {
+	return x.FloatString(s.decimals())
+}
+
+// Pair - currency pair: one unit of From, in To
+type Pair struct {
+	From string
+	To   string
+}
+
+func (p Pair) String() string {
+	return p.From + "/" + p.To
+}
+
+// ParsePairs - "EUR/USD,USD/CHF"
+func ParsePairs(s string) ([]Pair, error) {
+	var pairs []Pair
+
+	for _, elem := range strings.Split(s, ",") {
+		elem = strings.TrimSpace(elem)
+		if len(elem) == 0 {
+			continue
+		}
+
+		parts := strings.Split(elem, "/")
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[1])) == 0 {
+			return nil, fmt.Errorf("invalid currency pair: %s (ex: EUR/USD)", elem)
+		}
+
+		pairs = append(pairs, Pair{
+			From: strings.ToUpper(strings.TrimSpace(parts[0])),
+			To:   strings.ToUpper(strings.TrimSpace(parts[1])),
+		})
+	}
+
+	return pairs, nil
+}
+
+// CrossRate - value of one unit of Pair.From in Pair.To,
+// triangulated through the base currency of the provider
+type CrossRate struct {
+	Pair
+	Provider string
+	Base     string
+	Date     time.Time
+	From     *Rate
+	To       *Rate
+	Value    *big.Rat
+}
+
+// CrossRate - rate of the pair on the date (or on the previous fixing)
+func (s *Store) CrossRate(pair Pair, date time.Time) (*CrossRate, error) {
+	from, err := s.RateAt(pair.From, date)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := s.RateAt(pair.To, date)
+	if err != nil {
+		return nil, err
+	}
+
+	if to.Value.Sign() == 0 {
+		return nil, fmt.Errorf("zero exchange rate for %s", to.Currency)
+	}
+
+	value := new(big.Rat).Quo(from.Value, to.Value)
+
+	return &CrossRate{
+		Pair:     pair,
+		Provider: s.Provider,
+		Base:     s.Base,
+		Date:     truncate(date),
+		From:     from,
+		To:       to,
+		Value:    s.round(value),
+	}, nil
+}
+
+// PublishedRate - rate of the pair as published by the provider: only
+// pairs with the base currency of the provider on one side are published
+// (false if the pair is not one of them)
+func (s *Store) PublishedRate(pair Pair, date time.Time) (*big.Rat, bool, error) {
+	switch {
+	case pair.To == s.Base:
+		rate, err := s.RateAt(pair.From, date)
+		if err != nil {
+			return nil, true, err
+		}
+
+		return rate.Value, true, nil
+	case pair.From == s.Base:
+		rate, err := s.RateAt(pair.To, date)
+		if err != nil {
+			return nil, true, err
+		}
+
+		if rate.Value.Sign() == 0 {
+			return nil, true, fmt.Errorf("zero exchange rate for %s", rate.Currency)
+		}
+
+		return new(big.Rat).Inv(rate.Value), true, nil
+	}
+
+	return nil, false, nil
+}
+
+// Deviation - |a - b| / b
+func Deviation(a *big.Rat, b *big.Rat) *big.Rat {
+	d := new(big.Rat).Sub(a, b)
+	d.Abs(d)
+
+	if b.Sign() == 0 {
+		return d
+	}
+
+	return d.Quo(d, new(big.Rat).Abs(b))
+}
+
+// FixingDates - the dates with rates of the provider between from and to
+func (s *Store) FixingDates(from time.Time, to time.Time) ([]time.Time, error) {
+	pq := s.dbutl.PQuery(`
+		SELECT DISTINCT exchange_date
+		  FROM exchange_rate
+		 WHERE provider = ?
+		   AND base_currency = ?
+		   AND exchange_date >= DATE ?
+		   AND exchange_date <= DATE ?
+		 ORDER BY exchange_date
+	`, s.Provider,
+		s.Base,
+		truncate(from).Format("2006-01-02"),
+		truncate(to).Format("2006-01-02"))
+
+	rows, err := s.db.Query(pq.Query, pq.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dates []time.Time
+
+	for rows.Next() {
+		var dt time.Time
+		if err := rows.Scan(&dt); err != nil {
+			return nil, err
+		}
+
+		dates = append(dates, truncate(dt))
+	}
+
+	return dates, rows.Err()
+}
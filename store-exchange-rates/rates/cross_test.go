@@ -0,0 +1,102 @@
+package rates
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestRoundMode(t *testing.T) {
+	modes := []RoundingMode{HalfAwayFromZero, HalfEven, HalfTowardZero, TowardZero, AwayFromZero, Floor, Ceiling}
+
+	tests := []struct {
+		x        string
+		decimals int
+		// by mode, in the order of modes
+		want []string
+	}{
+		{"2.5", 0, []string{"3", "2", "2", "2", "3", "2", "3"}},
+		{"-2.5", 0, []string{"-3", "-2", "-2", "-2", "-3", "-3", "-2"}},
+		{"3.5", 0, []string{"4", "4", "3", "3", "4", "3", "4"}},
+		{"-3.5", 0, []string{"-4", "-4", "-3", "-3", "-4", "-4", "-3"}},
+		{"2.4", 0, []string{"2", "2", "2", "2", "3", "2", "3"}},
+		{"-2.4", 0, []string{"-2", "-2", "-2", "-2", "-3", "-3", "-2"}},
+		{"2.6", 0, []string{"3", "3", "3", "2", "3", "2", "3"}},
+		{"-2.6", 0, []string{"-3", "-3", "-3", "-2", "-3", "-3", "-2"}},
+		{"-2", 0, []string{"-2", "-2", "-2", "-2", "-2", "-2", "-2"}},
+		{"0", 2, []string{"0", "0", "0", "0", "0", "0", "0"}},
+		{"1.005", 2, []string{"1.01", "1", "1", "1", "1.01", "1", "1.01"}},
+		{"-1.005", 2, []string{"-1.01", "-1", "-1", "-1", "-1.01", "-1.01", "-1"}},
+		{"1.015", 2, []string{"1.02", "1.02", "1.01", "1.01", "1.02", "1.01", "1.02"}},
+		{"-1.015", 2, []string{"-1.02", "-1.02", "-1.01", "-1.01", "-1.02", "-1.02", "-1.01"}},
+		{"1/3", 6, []string{"0.333333", "0.333333", "0.333333", "0.333333", "0.333334", "0.333333", "0.333334"}},
+		{"-1/3", 6, []string{"-0.333333", "-0.333333", "-0.333333", "-0.333333", "-0.333334", "-0.333334", "-0.333333"}},
+		{"-2/3", 6, []string{"-0.666667", "-0.666667", "-0.666667", "-0.666666", "-0.666667", "-0.666667", "-0.666666"}},
+	}
+
+	for _, tt := range tests {
+		x, ok := new(big.Rat).SetString(tt.x)
+		if !ok {
+			t.Fatalf("invalid test value %s", tt.x)
+		}
+
+		for i, mode := range modes {
+			want, ok := new(big.Rat).SetString(tt.want[i])
+			if !ok {
+				t.Fatalf("invalid expected value %s", tt.want[i])
+			}
+
+			got := RoundMode(x, tt.decimals, mode)
+			if got.Cmp(want) != 0 {
+				t.Errorf("RoundMode(%s, %d, %s) = %s, want %s", tt.x, tt.decimals, mode, got.FloatString(tt.decimals), tt.want[i])
+			}
+		}
+	}
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    RoundingMode
+		wantErr bool
+	}{
+		{"", HalfAwayFromZero, false},
+		{" Half-Even ", HalfEven, false},
+		{"floor", Floor, false},
+		{"bankers", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRoundingMode(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRoundingMode(%q) error = %v, want error %v", tt.s, err, tt.wantErr)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("ParseRoundingMode(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestStoreText(t *testing.T) {
+	tests := []struct {
+		precision int
+		want      string
+	}{
+		{0, "5"},
+		{2, "4.57"},
+		{Decimals, "4.567891"},
+		{-1, "4.567891"},
+	}
+
+	x, _ := new(big.Rat).SetString("4.5678912")
+
+	for _, tt := range tests {
+		s := NewStore(nil, nil)
+		s.Precision = tt.precision
+
+		if got := s.Text(x); got != tt.want {
+			t.Errorf("Text with precision %d = %s, want %s", tt.precision, got, tt.want)
+		}
+	}
+}
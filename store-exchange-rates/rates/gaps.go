@@ -0,0 +1,75 @@
+package rates
+
+import (
+	"time"
+)
+
+// Fixing - stored rate of a currency
+type Fixing struct {
+	CurrencyID int32
+	Currency   string
+	Date       time.Time
+	Rate       string
+	// carried forward from a previous fixing
+	Carried bool
+}
+
+// Gap - a business day without a fixing of the currency
+type Gap struct {
+	CurrencyID int32
+	Currency   string
+	Date       time.Time
+	// the last rate before Date
+	Rate string
+}
+
+// FindGaps - the business days from from to to without a fixing, for each
+// currency; the fixings are ordered by currency and date. A currency is
+// checked from its first fixing to its last one, or to to when its last
+// fixing is the last one of all (it is still published)
+func FindGaps(fixings []Fixing, calendar *Calendar, from time.Time, to time.Time) []Gap {
+	var gaps []Gap
+	var lastFixing time.Time
+
+	for _, f := range fixings {
+		if f.Date.After(lastFixing) {
+			lastFixing = f.Date
+		}
+	}
+
+	for i := 0; i < len(fixings); {
+		j := i
+		for j < len(fixings) && fixings[j].Currency == fixings[i].Currency {
+			j++
+		}
+
+		rows := fixings[i:j]
+		i = j
+
+		// still published: checked until to
+		end := rows[len(rows)-1].Date
+		if end.Equal(lastFixing) {
+			end = to
+		}
+
+		k := 0
+		for dt := rows[0].Date; !dt.After(end); dt = dt.AddDate(0, 0, 1) {
+			if k < len(rows)-1 && !rows[k+1].Date.After(dt) {
+				k++
+			}
+
+			if rows[k].Date.Equal(dt) || dt.Before(from) || !calendar.IsBusinessDay(dt) {
+				continue
+			}
+
+			gaps = append(gaps, Gap{
+				CurrencyID: rows[k].CurrencyID,
+				Currency:   rows[k].Currency,
+				Date:       dt,
+				Rate:       rows[k].Rate,
+			})
+		}
+	}
+
+	return gaps
+}
@@ -0,0 +1,109 @@
+package rates
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindGaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		calendar string
+		// "USD 2024-04-30 4.65", ordered by currency and date
+		fixings []string
+		from    string
+		to      string
+		// "USD 2024-05-02 4.65"
+		want []string
+	}{
+		{
+			name:     "easter week holidays",
+			calendar: "RO",
+			fixings:  []string{"USD 2024-04-30 4.65", "USD 2024-05-02 4.66", "USD 2024-05-07 4.62"},
+			from:     "2024-04-29",
+			to:       "2024-05-07",
+		},
+		{
+			name:     "missing day between holidays",
+			calendar: "RO",
+			fixings:  []string{"USD 2024-04-30 4.65", "USD 2024-05-07 4.62"},
+			from:     "2024-04-29",
+			to:       "2024-05-07",
+			want:     []string{"USD 2024-05-02 4.65"},
+		},
+		{
+			name:     "weekends only",
+			calendar: "NONE",
+			fixings:  []string{"USD 2024-04-30 4.65", "USD 2024-05-02 4.66", "USD 2024-05-07 4.62"},
+			from:     "2024-04-29",
+			to:       "2024-05-07",
+			want:     []string{"USD 2024-05-01 4.65", "USD 2024-05-03 4.66", "USD 2024-05-06 4.66"},
+		},
+		{
+			name:     "still published until to",
+			calendar: "RO",
+			fixings:  []string{"USD 2024-05-07 4.62"},
+			from:     "2024-05-01",
+			to:       "2024-05-10",
+			want:     []string{"USD 2024-05-08 4.62", "USD 2024-05-09 4.62", "USD 2024-05-10 4.62"},
+		},
+		{
+			name:     "no longer published",
+			calendar: "RO",
+			fixings:  []string{"GBP 2024-04-29 5.82", "GBP 2024-04-30 5.81", "USD 2024-04-30 4.65", "USD 2024-05-02 4.66", "USD 2024-05-07 4.62"},
+			from:     "2024-04-29",
+			to:       "2024-05-08",
+			want:     []string{"USD 2024-05-08 4.62"},
+		},
+		{
+			name:     "gaps before from are not reported",
+			calendar: "RO",
+			fixings:  []string{"USD 2024-04-25 4.66", "USD 2024-05-07 4.62"},
+			from:     "2024-05-01",
+			to:       "2024-05-07",
+			want:     []string{"USD 2024-05-02 4.66"},
+		},
+		{
+			name:     "christmas and new year",
+			calendar: "RO",
+			fixings:  []string{"EUR 2024-12-23 4.97", "EUR 2024-12-24 4.97", "EUR 2025-01-03 4.97"},
+			from:     "2024-12-23",
+			to:       "2025-01-03",
+			want:     []string{"EUR 2024-12-27 4.97", "EUR 2024-12-30 4.97", "EUR 2024-12-31 4.97"},
+		},
+	}
+
+	for _, tt := range tests {
+		calendar, err := NewCalendar(tt.calendar, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		var fixings []Fixing
+		for _, f := range tt.fixings {
+			parts := strings.Fields(f)
+			fixings = append(fixings, Fixing{Currency: parts[0], Date: testDate(t, parts[1]), Rate: parts[2]})
+		}
+
+		var got []string
+		for _, g := range FindGaps(fixings, calendar, testDate(t, tt.from), testDate(t, tt.to)) {
+			got = append(got, fmt.Sprintf("%s %s %s", g.Currency, g.Date.Format("2006-01-02"), g.Rate))
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: FindGaps = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testDate(t *testing.T, s string) time.Time {
+	date, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatalf("invalid test date %s", s)
+	}
+
+	return date
+}
@@ -0,0 +1,237 @@
+// Package rates reads the exchange rates stored by store-exchange-rates.
+//
+// The rates are the value of one unit of each currency in the base currency
+// of their provider: RON for BNR (the default), EUR for ECB. A date without
+// a fixing (weekend, holiday) uses the previous fixing, as long as it is not
+// older than LookbackDays business days of the Calendar, and any two
+// currencies are converted through the base currency. The arithmetic is done with
+// math/big and the results are rounded to 6 decimals, halves away from zero.
+// The rates are stored with 12 decimals, enough for the inverted quotes of
+// the weak currencies (ECB: 1 / 17000 IDR per EUR).
+package rates
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/geo-stanciu/go-utils/utils"
+)
+
+// DefaultProvider - provider read by NewStore
+const DefaultProvider = "BNR"
+
+// Pivot - base currency of the default provider
+const Pivot = "RON"
+
+// Decimals - precision of the conversions, and least one of the rates shown
+const Decimals = 6
+
+// RateDecimals - precision of the stored rates
+const RateDecimals = 12
+
+// DefaultLookbackDays - a date uses at most the fixing of the previous business day
+const DefaultLookbackDays = 1
+
+// ErrNoRate - no recent fixing of the currency on or before the date
+var ErrNoRate = errors.New("no exchange rate")
+
+// Rate - value of one unit of the currency in the base currency
+type Rate struct {
+	Currency string
+	// the requested date
+	Date time.Time
+	// date of the fixing used (the last one on or before Date)
+	FixingDate time.Time
+	Value      *big.Rat
+}
+
+// Conversion - amount converted between two currencies
+type Conversion struct {
+	Amount *big.Rat
+	From   *Rate
+	To     *Rate
+	Result *big.Rat
+}
+
+// Store - reads the rates of a provider from the exchange_rate table
+type Store struct {
+	Provider string
+	Base     string
+	// of the cross rates and conversions (Decimals from NewStore,
+	// half-away); 0 rounds to units
+	Precision int
+	Rounding  RoundingMode
+	// business days (weekends only if nil) a fixing may be older than
+	// the date (default DefaultLookbackDays)
+	Calendar     *Calendar
+	LookbackDays int
+	db           *sql.DB
+	dbutl        *utils.DbUtils
+}
+
+// NewStore - Store reading the BNR rates through the connection
+func NewStore(db *sql.DB, dbutl *utils.DbUtils) *Store {
+	return &Store{
+		Provider:  DefaultProvider,
+		Base:      Pivot,
+		Precision: Decimals,
+		db:        db,
+		dbutl:     dbutl,
+	}
+}
+
+// oldestFixing - the oldest fixing used for the date
+func (s *Store) oldestFixing(day time.Time) time.Time {
+	calendar := s.Calendar
+	if calendar == nil {
+		calendar, _ = NewCalendar("NONE", nil)
+	}
+
+	days := s.LookbackDays
+	if days <= 0 {
+		days = DefaultLookbackDays
+	}
+
+	for days > 0 {
+		day = day.AddDate(0, 0, -1)
+
+		if calendar.IsBusinessDay(day) {
+			days--
+		}
+	}
+
+	return day
+}
+
+// RateAt - rate of the currency on the date, or of its previous fixing
+// (ErrNoRate if that is older than the lookback: the currency is no
+// longer published, or the rates were not imported)
+func (s *Store) RateAt(currency string, date time.Time) (*Rate, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	day := truncate(date)
+
+	if currency == s.Base {
+		return &Rate{Currency: s.Base, Date: day, FixingDate: day, Value: big.NewRat(1, 1)}, nil
+	}
+
+	var fixingDate time.Time
+	var value string
+
+	oldest := s.oldestFixing(day)
+
+	pq := s.dbutl.PQuery(`
+		SELECT r.exchange_date,
+		       r.rate
+		  FROM exchange_rate r
+		  JOIN currency c ON (r.currency_id = c.currency_id)
+		 WHERE r.provider = ?
+		   AND r.base_currency = ?
+		   AND c.currency = ?
+		   AND r.exchange_date = (
+				SELECT max(exchange_date)
+				  FROM exchange_rate
+				 WHERE provider = r.provider
+				   AND base_currency = r.base_currency
+				   AND currency_id = r.currency_id
+				   AND exchange_date <= DATE ?
+				   AND exchange_date >= DATE ?
+		   )
+	`, s.Provider,
+		s.Base,
+		currency,
+		day.Format("2006-01-02"),
+		oldest.Format("2006-01-02"))
+
+	err := s.db.QueryRow(pq.Query, pq.Args...).Scan(&fixingDate, &value)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s on %s, no fixing since %s (%s)",
+			ErrNoRate,
+			currency,
+			day.Format("2006-01-02"),
+			oldest.Format("2006-01-02"),
+			s.Provider)
+	} else if err != nil {
+		return nil, err
+	}
+
+	rate, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid rate %s for %s", value, currency)
+	}
+
+	return &Rate{
+		Currency:   currency,
+		Date:       day,
+		FixingDate: truncate(fixingDate),
+		Value:      rate,
+	}, nil
+}
+
+// Convert - the amount in the currency from, in the currency to, on the date
+func (s *Store) Convert(amount *big.Rat, from string, to string, date time.Time) (*Conversion, error) {
+	fromRate, err := s.RateAt(from, date)
+	if err != nil {
+		return nil, err
+	}
+
+	toRate, err := s.RateAt(to, date)
+	if err != nil {
+		return nil, err
+	}
+
+	if toRate.Value.Sign() == 0 {
+		return nil, fmt.Errorf("zero exchange rate for %s", toRate.Currency)
+	}
+
+	result := new(big.Rat).Mul(amount, fromRate.Value)
+	result.Quo(result, toRate.Value)
+
+	return &Conversion{
+		Amount: amount,
+		From:   fromRate,
+		To:     toRate,
+		Result: s.round(result),
+	}, nil
+}
+
+// Round - x rounded to the decimals, halves away from zero
+func Round(x *big.Rat, decimals int) *big.Rat {
+	return RoundMode(x, decimals, HalfAwayFromZero)
+}
+
+// Format - x with the decimals (FloatString rounds halves away from zero)
+func Format(x *big.Rat, decimals int) string {
+	return x.FloatString(decimals)
+}
+
+// FormatRate - the rate with its significant decimals, at least Decimals
+// and at most RateDecimals: 4.976500, 0.000058823529
+func FormatRate(x *big.Rat) string {
+	s := x.FloatString(RateDecimals)
+
+	keep := len(s) - (RateDecimals - Decimals)
+	for len(s) > keep && s[len(s)-1] == '0' {
+		s = s[:len(s)-1]
+	}
+
+	return s
+}
+
+// ParseAmount - decimal amount, ex: 1234.56
+func ParseAmount(s string) (*big.Rat, error) {
+	amount, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, fmt.Errorf("invalid amount: %s", s)
+	}
+
+	return amount, nil
+}
+
+func truncate(date time.Time) time.Time {
+	y, m, d := date.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"database/sql"
+	"math/big"
+	"time"
+)
+
+// In reconcile mode the rates read from the source are compared with the
+// stored ones instead of being skipped when the date was imported. Each
+// difference (a corrected fixing, a rate missing from the table or one
+// carried forward by -check -fill) is recorded in exchange_rate_revision
+// and, with -apply, written to exchange_rate.
+
+// reconcileStats - reconcile mode and what it found
+type reconcileStats struct {
+	Enabled     bool
+	Apply       bool
+	Checked     int
+	Differences int
+	Applied     int
+}
+
+var reconciling reconcileStats
+
+// getStoredRate - the stored rate of the currency on the date, if it was
+// carried forward by -check -fill (false if there is none)
+func getStoredRate(tx *sql.Tx, currencyID int32, date string) (string, bool, bool, error) {
+	var rate string
+	carried := 0
+
+	pq := dbutl.PQuery(`
+		SELECT rate, carried
+		  FROM exchange_rate
+		 WHERE provider = ?
+		   AND base_currency = ?
+		   AND currency_id = ?
+		   AND exchange_date = DATE ?
+	`, provider.Name,
+		provider.BaseCurrency,
+		currencyID,
+		date)
+
+	err := tx.QueryRow(pq.Query, pq.Args...).Scan(&rate, &carried)
+	if err == sql.ErrNoRows {
+		return "", false, false, nil
+	} else if err != nil {
+		return "", false, false, err
+	}
+
+	return rate, carried == 1, true, nil
+}
+
+func sameRate(stored string, rate string) bool {
+	a, ok := new(big.Rat).SetString(stored)
+	if !ok {
+		return false
+	}
+
+	b, ok := new(big.Rat).SetString(rate)
+	if !ok {
+		return false
+	}
+
+	return a.Cmp(b) == 0
+}
+
+// reconcileRate - record (and apply) the rate if it differs from the stored one
+func reconcileRate(tx *sql.Tx, date string, currency string, currencyID int32, rate string) error {
+	reconciling.Checked++
+
+	stored, carried, found, err := getStoredRate(tx, currencyID, date)
+	if err != nil {
+		return err
+	}
+
+	// a carried rate is replaced by the fixing, even when equal
+	if found && !carried && sameRate(stored, rate) {
+		return nil
+	}
+
+	reconciling.Differences++
+
+	oldRate := sql.NullString{String: stored, Valid: found}
+
+	if err = recordRevision(tx, currencyID, date, oldRate, rate); err != nil {
+		return err
+	}
+
+	if reconciling.Apply {
+		if found {
+			pq := dbutl.PQuery(`
+				UPDATE exchange_rate
+				   SET rate = ?,
+				       carried = 0
+				 WHERE provider = ?
+				   AND base_currency = ?
+				   AND currency_id = ?
+				   AND exchange_date = DATE ?
+			`, rate,
+				provider.Name,
+				provider.BaseCurrency,
+				currencyID,
+				date)
+
+			_, err = dbutl.ExecTx(tx, pq)
+		} else {
+			err = insertRate(tx, currencyID, date, rate)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		reconciling.Applied++
+	}
+
+	audit.Log(nil,
+		"reconcile exchange rates",
+		"rate differs",
+		"provider", provider.Name,
+		"date", date,
+		"currency", currency,
+		"stored_rate", oldRate.String,
+		"feed_rate", rate,
+		"applied", reconciling.Apply)
+
+	return nil
+}
+
+// recordRevision - add the difference to exchange_rate_revision, unless
+// the same one is already waiting to be applied
+func recordRevision(tx *sql.Tx, currencyID int32, date string, oldRate sql.NullString, rate string) error {
+	found := 0
+
+	pq := dbutl.PQuery(`
+		SELECT CASE WHEN EXISTS (
+			SELECT 1
+			FROM exchange_rate_revision
+		   WHERE provider = ?
+			 AND base_currency = ?
+			 AND currency_id = ?
+			 AND exchange_date = DATE ?
+			 AND new_rate = ?
+			 AND applied = 0
+		) THEN 1 ELSE 0 END
+		FROM dual
+	`, provider.Name,
+		provider.BaseCurrency,
+		currencyID,
+		date,
+		rate)
+
+	err := tx.QueryRow(pq.Query, pq.Args...).Scan(&found)
+	if err != nil {
+		return err
+	}
+
+	applied := 0
+	if reconciling.Apply {
+		applied = 1
+	}
+
+	if found == 1 {
+		if !reconciling.Apply {
+			return nil
+		}
+
+		pq = dbutl.PQuery(`
+			UPDATE exchange_rate_revision
+			   SET applied = 1
+			 WHERE provider = ?
+			   AND base_currency = ?
+			   AND currency_id = ?
+			   AND exchange_date = DATE ?
+			   AND new_rate = ?
+			   AND applied = 0
+		`, provider.Name,
+			provider.BaseCurrency,
+			currencyID,
+			date,
+			rate)
+	} else {
+		pq = dbutl.PQuery(`
+			INSERT INTO exchange_rate_revision (
+				provider,
+				base_currency,
+				currency_id,
+				exchange_date,
+				old_rate,
+				new_rate,
+				detected_time,
+				applied
+			)
+			VALUES (?, ?, ?, DATE ?, ?, ?, ?, ?)
+		`, provider.Name,
+			provider.BaseCurrency,
+			currencyID,
+			date,
+			oldRate,
+			rate,
+			time.Now().UTC(),
+			applied)
+	}
+
+	_, err = dbutl.ExecTx(tx, pq)
+
+	return err
+}
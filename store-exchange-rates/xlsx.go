@@ -0,0 +1,198 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// The XLSX files are written with archive/zip: a workbook with a sheet per
+// table, the header in bold and frozen, the dates as Excel dates and the
+// rates as numbers with 6 to 12 decimals, the carried ones in italics. The
+// strings are inline, so there is no shared strings part.
+
+const (
+	xlsxMainNS = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	xlsxRelNS  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	xlsxPkgNS  = "http://schemas.openxmlformats.org/package/2006/relationships"
+)
+
+// cell styles of xlsxStyles
+const (
+	xlsxStyleHeader  = 1
+	xlsxStyleDate    = 2
+	xlsxStyleMonth   = 3
+	xlsxStyleRate    = 4
+	xlsxStyleCarried = 5
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="` + xlsxMainNS + `">
+<numFmts count="3"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/><numFmt numFmtId="165" formatCode="yyyy-mm"/><numFmt numFmtId="166" formatCode="0.000000######"/></numFmts>
+<fonts count="3"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font><font><i/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="6">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="166" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="166" fontId="2" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" applyFont="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+// xlsxPart - file of the zip
+type xlsxPart struct {
+	Name    string
+	Content string
+}
+
+// day 0 of the Excel dates
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+func writeXLSXTables(file string, tables []*exportTable) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = writeXLSX(f, tables); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// writeXLSX - the workbook with a sheet per table
+func writeXLSX(w io.Writer, tables []*exportTable) error {
+	var types, sheets, rels bytes.Buffer
+
+	for i, t := range tables {
+		n := i + 1
+
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(t.Name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, n, xlsxRelNS, n)
+	}
+
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/>`, len(tables)+1, xlsxRelNS)
+
+	parts := []xlsxPart{
+		{"[Content_Types].xml", xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="` + xlsxPkgNS + `">` +
+			`<Relationship Id="rId1" Type="` + xlsxRelNS + `/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xmlHeader + `<workbook xmlns="` + xlsxMainNS + `" xmlns:r="` + xlsxRelNS + `">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xmlHeader + `<Relationships xmlns="` + xlsxPkgNS + `">` +
+			rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+
+	for i, t := range tables {
+		parts = append(parts, xlsxPart{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxSheet(t)})
+	}
+
+	z := zip.NewWriter(w)
+
+	for _, p := range parts {
+		pw, err := z.Create(p.Name)
+		if err != nil {
+			return err
+		}
+
+		if _, err = io.WriteString(pw, p.Content); err != nil {
+			return err
+		}
+	}
+
+	return z.Close()
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// xlsxSheet - the worksheet of the table
+func xlsxSheet(t *exportTable) string {
+	var b bytes.Buffer
+
+	b.WriteString(xmlHeader)
+	b.WriteString(`<worksheet xmlns="` + xlsxMainNS + `">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0">` +
+		`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>` +
+		`</sheetView></sheetViews>`)
+	b.WriteString(`<sheetData>`)
+
+	b.WriteString(`<row r="1">`)
+	for i, h := range t.header() {
+		fmt.Fprintf(&b, `<c r="%s1" t="inlineStr" s="%d"><is><t>%s</t></is></c>`, xlsxColumn(i), xlsxStyleHeader, xmlEscape(h))
+	}
+	b.WriteString(`</row>`)
+
+	keyStyle := xlsxStyleDate
+	if t.Key == "month" {
+		keyStyle = xlsxStyleMonth
+	}
+
+	for r, row := range t.Rows {
+		n := r + 2
+
+		fmt.Fprintf(&b, `<row r="%d">`, n)
+		fmt.Fprintf(&b, `<c r="A%d" s="%d"><v>%d</v></c>`, n, keyStyle, int(row.Date.Sub(xlsxEpoch).Hours()/24))
+
+		for i, rate := range row.Rates {
+			if rate == nil {
+				continue
+			}
+
+			style := xlsxStyleRate
+			if row.Carried != nil && row.Carried[i] {
+				style = xlsxStyleCarried
+			}
+
+			fmt.Fprintf(&b, `<c r="%s%d" s="%d"><v>%s</v></c>`, xlsxColumn(i+1), n, style, formatRate(rate))
+		}
+
+		if t.WithCarried {
+			if carried := t.carriedCurrencies(&row); len(carried) > 0 {
+				fmt.Fprintf(&b, `<c r="%s%d" t="inlineStr"><is><t>%s</t></is></c>`, xlsxColumn(len(row.Rates)+1), n, xmlEscape(carried))
+			}
+		}
+
+		b.WriteString(`</row>`)
+	}
+
+	b.WriteString(`</sheetData></worksheet>`)
+
+	return b.String()
+}
+
+// xlsxColumn - name of the column: A, B, ..., Z, AA, ...
+func xlsxColumn(i int) string {
+	name := ""
+
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+
+	return b.String()
+}